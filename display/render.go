@@ -16,6 +16,14 @@ const (
 
 var borderColor = color.RGBA{0xBD, 0xBD, 0xBD, 0xBD}
 
+// the outline of a masked board
+var outlineColor = color.RGBA{0xFF, 0x57, 0x22, 0xFF}
+
+// the border of a piece that was fixed before solving, and how thick it is
+var fixedColor = color.RGBA{0x9E, 0x9E, 0x9E, 0xFF}
+
+const fixedBorder = 3
+
 // converts game w to img w
 func imgw(cols int) int {
 	return tile*cols + pad*(cols+1)
@@ -46,6 +54,19 @@ func Render(w, h int, plays []*Play, out io.Writer) {
 	g.save(out)
 }
 
+// renders the plays on a board of the cells set in the mask, with the grid
+// drawn only around them and the mask outlined
+func RenderMasked(mask *Grid, plays []*Play, out io.Writer) {
+	g := &Graf{
+		img: NewRGBA(Rect(0, 0, imgw(mask.W), imgh(mask.H))),
+	}
+	g.drawMask(mask.W, mask.H, mask.IsSet, imgRect)
+	for _, play := range plays {
+		g.drawPlay(play)
+	}
+	g.save(out)
+}
+
 type Graf struct {
 	img *RGBA
 	c   color.Color
@@ -77,6 +98,38 @@ func (g *Graf) drawGrid() {
 	}
 }
 
+// draws the grid lines around each cell of a w x h mask that's in it, with
+// rect the tile of a cell, then the edges of the cells next to cells that
+// aren't in it in the outline color
+func (g *Graf) drawMask(w, h int, in func(x, y int) bool, rect func(x, y int) Rectangle) {
+	for _, outline := range []bool{false, true} {
+		g.c = color.White
+		if outline {
+			g.c = outlineColor
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if !in(x, y) {
+					continue
+				}
+				t := rect(x, y)
+				if !outline || !in(x, y-1) {
+					g.DrawRect(t.Min.X-pad, t.Min.Y-pad, t.Max.X+pad, t.Min.Y)
+				}
+				if !outline || !in(x, y+1) {
+					g.DrawRect(t.Min.X-pad, t.Max.Y, t.Max.X+pad, t.Max.Y+pad)
+				}
+				if !outline || !in(x-1, y) {
+					g.DrawRect(t.Min.X-pad, t.Min.Y-pad, t.Min.X, t.Max.Y+pad)
+				}
+				if !outline || !in(x+1, y) {
+					g.DrawRect(t.Max.X, t.Min.Y-pad, t.Max.X+pad, t.Max.Y+pad)
+				}
+			}
+		}
+	}
+}
+
 type edges struct {
 	u, d, l, r bool
 }
@@ -139,7 +192,18 @@ func (g *Graf) drawPlay(play *Play) {
 		255,
 	}
 	eachTile(play, pcol, g.drawTile)
-	eachTile(play, borderColor, g.drawBorders)
+	if play.Fixed {
+		eachTile(play, fixedColor, g.drawFixedBorders)
+	} else {
+		eachTile(play, borderColor, g.drawBorders)
+	}
+}
+
+// a border fixedBorder thick, drawn a border at a time from the edges in
+func (g *Graf) drawFixedBorders(t Rectangle, bc color.Color, b edges) {
+	for i := 0; i < fixedBorder; i++ {
+		g.drawBorders(t.Inset(i*border), bc, b)
+	}
 }
 
 func eachTile(play *Play, c color.Color, draw func(Rectangle, color.Color, edges)) {
@@ -37,6 +37,22 @@ func Render3D(w, h, d int, plays []*Play3D, out io.Writer) {
 	g.save(out)
 }
 
+// renders the plays in a cube of the cells set in the mask, like RenderMasked
+func Render3DMasked(mask *Grid3D, plays []*Play3D, out io.Writer) {
+	g := &Graf{
+		img: NewRGBA(Rect(0, 0, imgw(mask.W), imgh3D(mask.H, mask.D))),
+	}
+	for z := 0; z < mask.D; z++ {
+		in := func(x, y int) bool { return mask.IsSet(x, y, z) }
+		rect := func(x, y int) Rectangle { return imgRect3D(mask.H, x, y, z) }
+		g.drawMask(mask.W, mask.H, in, rect)
+	}
+	for _, play := range plays {
+		g.drawPlay3D(mask.H, play)
+	}
+	g.save(out)
+}
+
 func (g *Graf) drawGrid3D(h, d int) {
 	g.drawGrid()
 	// erase in-between lines
@@ -0,0 +1,71 @@
+package dlx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/leonprime/byf/dlx"
+	"github.com/leonprime/byf/game"
+)
+
+// the pentomino cases from the README
+var benchGames = []struct {
+	name    string
+	w, h, d int
+}{
+	{"20x3", 20, 3, 0},
+	{"2x3x10", 2, 3, 10},
+}
+
+func benchCoverage(b *testing.B, w, h, d int) *game.Coverage {
+	lib, err := game.LoadLibrary("../data/pentominoes.txt", true)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if d == 0 {
+		board, err := game.NewBoard(lib, w, h, "FILNPTUVWXYZ")
+		if err != nil {
+			b.Fatal(err)
+		}
+		return board.Coverage
+	}
+	cube, err := game.NewCube(lib, w, h, d, "FILNPTUVWXYZ")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return cube.Coverage
+}
+
+func BenchmarkSearch(b *testing.B) {
+	for _, g := range benchGames {
+		cov := benchCoverage(b, g.w, g.h, g.d)
+		b.Run(g.name+"/links", func(b *testing.B) {
+			dl := dlx.NewSparse(cov.Options, cov.Columns, nil, nil)
+			for i := 0; i < b.N; i++ {
+				dl.Search(context.Background(), nil)
+			}
+		})
+		b.Run(g.name+"/flat", func(b *testing.B) {
+			dl := dlx.NewFlatSparse(cov.Options, cov.Columns, nil)
+			for i := 0; i < b.N; i++ {
+				dl.Search(context.Background(), nil)
+			}
+		})
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	cov := benchCoverage(b, 2, 5, 6)
+	b.Run("links", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			dlx.NewSparse(cov.Options, cov.Columns, nil, nil)
+		}
+	})
+	b.Run("flat", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			dlx.NewFlatSparse(cov.Options, cov.Columns, nil)
+		}
+	})
+}
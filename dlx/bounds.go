@@ -0,0 +1,150 @@
+package dlx
+
+import "fmt"
+
+// SetBounds lets primary column x be covered by anywhere from lo to hi rows
+// instead of exactly one, like Knuth's DLX3.  Each combination of rows is
+// found once: when branching on a bounded column, the rows are tried in order
+// as the first of the column's remaining rows to choose, so rows above it are
+// left out of that branch, and a last branch chooses no more rows for it.
+// Bounds on a secondary column, or out of order, are a *MatrixError
+func (dl *DancingLinks) SetBounds(x, lo, hi int) error {
+	if x < 0 || x >= len(dl.cols) {
+		return &MatrixError{Row: -1, Reason: fmt.Sprintf("column %d out of range for bounds", x)}
+	}
+	c := dl.cols[x]
+	if c.secondary {
+		return &MatrixError{Row: -1, Reason: fmt.Sprintf("secondary column %s can't have bounds", c)}
+	}
+	if lo < 0 || hi < 1 || lo > hi {
+		return &MatrixError{Row: -1, Reason: fmt.Sprintf("bad bounds [%d, %d] for column %s", lo, hi, c)}
+	}
+	c.lo, c.hi = lo, hi
+	return nil
+}
+
+func (c *Column) bounded() bool {
+	return c.lo != 1 || c.hi != 1
+}
+
+// the number of branches a bounded column has left: a branch per row
+// plus one that stops using the column, less the rows it still needs.
+// this is 0 or less when there aren't enough rows to meet the lower bound
+func (c *Column) branches() int {
+	need := c.lo - c.used
+	if need < 0 {
+		need = 0
+	}
+	return c.S + 1 - need
+}
+
+// the number of branches the search takes on column c
+func (c *Column) degree() int {
+	if !c.bounded() {
+		return c.S
+	}
+	if c.branches() <= 0 {
+		return 0
+	}
+	if c.used >= c.lo {
+		return c.S + 1
+	}
+	return c.S
+}
+
+// branches on bounded column c at level k
+func (dl *DancingLinks) searchBounded(k int, c *Column) {
+	if c.branches() <= 0 {
+		return
+	}
+	replay, y := dl.replaying(k)
+	// rows tried so far are removed, either they're chosen in this branch
+	// or they were passed over in favor of a row further down
+	var removed []*Node
+	done := false
+	for r := c.D; r != &c.Node && !dl.stop; r = r.D {
+		dl.remove(r)
+		removed = append(removed, r)
+		if replay && r.y != y {
+			continue
+		}
+		dl.o[k] = r
+		dl.use(c)
+		dl.commitRow(r)
+		dl.search(k + 1)
+		dl.uncommitRow(r)
+		dl.unuse(c)
+		if replay {
+			replay = false
+			if dl.walk.replayed(k) {
+				done = true
+				break
+			}
+		}
+	}
+	if replay && y >= 0 {
+		dl.walk.lost = true
+	}
+	// the last branch chooses no more rows for c
+	if !done && !dl.stop && c.used >= c.lo {
+		dl.o[k] = nil
+		dl.cover(c)
+		dl.search(k + 1)
+		dl.uncover(c)
+		if replay {
+			dl.walk.replayed(k)
+		}
+	}
+	for i := len(removed) - 1; i >= 0; i-- {
+		dl.restore(removed[i])
+	}
+}
+
+// counts a chosen row against bounded column c.  c is covered once it's used up
+func (dl *DancingLinks) use(c *Column) {
+	c.used++
+	if c.used == c.hi {
+		dl.cover(c)
+	}
+}
+
+// inverse of use
+func (dl *DancingLinks) unuse(c *Column) {
+	if c.used == c.hi {
+		dl.uncover(c)
+	}
+	c.used--
+}
+
+// removes the row of node r from every column list it's in, including r's own
+func (dl *DancingLinks) remove(r *Node) {
+	j := r
+	for {
+		if j.color >= 0 {
+			j.D.U = j.U
+			j.U.D = j.D
+			j.C.S -= 1
+			dl.ops.updates++
+		}
+		j = j.R
+		if j == r {
+			break
+		}
+	}
+}
+
+// inverse of remove
+func (dl *DancingLinks) restore(r *Node) {
+	j := r
+	for {
+		j = j.L
+		if j.color >= 0 {
+			j.C.S += 1
+			j.D.U = j
+			j.U.D = j
+		}
+		if j == r {
+			break
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package dlx
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checkpoint is a position in the search: the node reached by choosing the
+// rows in Path at each level (-1 where no row was chosen), with N solutions
+// found and S steps taken before it.  Everything before the node in the search
+// order is done and the node itself is not started.
+// Rows and Columns are the size of the coverage matrix the search is over,
+// Matrix is a hash of it, and Chooser names the rule for choosing columns
+type Checkpoint struct {
+	Rows, Columns int
+	Matrix        string
+	Chooser       string
+	N, S          int
+	Path          []int
+}
+
+var ErrCheckpoint = errors.New("checkpoint doesn't match the coverage matrix")
+
+// ErrChooser is a checkpoint taken choosing columns another way, which
+// searches another tree
+var ErrChooser = errors.New("checkpoint was taken with another column chooser")
+
+// how many search nodes to visit between looking at the clock
+const tickNodes = 1 << 16
+
+// SetCheckpoint calls fn with the position of the search about every interval
+// while it runs.  fn is called from the searching goroutine.
+// Only Search and Resume take checkpoints, not SearchParallel
+func (dl *DancingLinks) SetCheckpoint(every time.Duration, fn func(*Checkpoint)) {
+	dl.every = every
+	dl.saveFn = fn
+}
+
+// Halted returns the position where the last search was cancelled,
+// or nil if it wasn't.  The search can be picked up from there with Resume
+func (dl *DancingLinks) Halted() *Checkpoint {
+	return dl.halt
+}
+
+// Resume continues a search from a checkpoint taken on the same coverage
+// matrix with the same chooser.  It works like Search and N and S carry on
+// from the checkpoint's
+func (dl *DancingLinks) Resume(ctx context.Context, cp *Checkpoint, fn func(Solution) bool) error {
+	if cp.Rows != len(dl.options) || cp.Columns != len(dl.columnNames) || cp.Matrix != dl.matrixHash() {
+		return ErrCheckpoint
+	}
+	if cp.Chooser != dl.chooserName() {
+		return ErrChooser
+	}
+	w := &walk{path: append([]int(nil), cp.Path...), resume: true, n: cp.N, s: cp.S}
+	dl.N, dl.S = 0, 0
+	dl.o = dl.o[:0]
+	dl.start(ctx, fn)
+	dl.walk = w
+	dl.search(0)
+	dl.walk = nil
+	if w.lost || w.resume {
+		return ErrCheckpoint
+	}
+	if dl.cancelled {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// the position of the search on entering the node at level k,
+// which has already been counted in S
+func (dl *DancingLinks) checkpoint(k int) *Checkpoint {
+	return &Checkpoint{
+		Rows:    len(dl.options),
+		Columns: len(dl.columnNames),
+		Matrix:  dl.matrixHash(),
+		Chooser: dl.chooserName(),
+		N:       dl.N,
+		S:       dl.S - 1,
+		Path:    dl.path(k),
+	}
+}
+
+// a hash of everything that shapes the search tree: the options in order
+// with their colors, and the kind and bounds of each column
+func (dl *DancingLinks) matrixHash() string {
+	h := fnv.New64a()
+	for x, name := range dl.columnNames {
+		c := dl.cols[x]
+		fmt.Fprintf(h, "%s %v %d %d\n", name, c.secondary, c.lo, c.hi)
+	}
+	for y, option := range dl.options {
+		for i, x := range option {
+			color := ""
+			if dl.colors != nil {
+				color = dl.colors[y][i]
+			}
+			fmt.Fprintf(h, "%d:%s ", x, color)
+		}
+		fmt.Fprintln(h)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// the name of the chooser: its String if it has one, or else its type
+func (dl *DancingLinks) chooserName() string {
+	switch ch := dl.chooser.(type) {
+	case nil:
+		return MRV{}.String()
+	case fmt.Stringer:
+		return ch.String()
+	default:
+		return fmt.Sprintf("%T", ch)
+	}
+}
+
+// called on entering each node at level k.  takes a checkpoint if it's time
+func (dl *DancingLinks) tick(k int) {
+	dl.ticks++
+	if dl.ticks%tickNodes != 0 || time.Now().Sub(dl.last) < dl.every {
+		return
+	}
+	dl.last = time.Now()
+	dl.saveFn(dl.checkpoint(k))
+}
+
+// Write the checkpoint in a line-based text format
+func (cp *Checkpoint) Write(w io.Writer) error {
+	path := make([]string, len(cp.Path))
+	for i, y := range cp.Path {
+		path[i] = strconv.Itoa(y)
+	}
+	_, err := fmt.Fprintf(w, "dlx checkpoint\nmatrix %d %d\nhash %s\nchooser %s\nsolutions %d\nsteps %d\npath %s\n",
+		cp.Rows, cp.Columns, cp.Matrix, cp.Chooser, cp.N, cp.S, strings.Join(path, " "))
+	return err
+}
+
+// ReadCheckpoint reads a checkpoint written by Checkpoint.Write
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	cp := &Checkpoint{}
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "dlx":
+			if line != 1 || len(fields) != 2 || fields[1] != "checkpoint" {
+				err = errors.New("bad header")
+			}
+		case "matrix":
+			err = parseInts(fields[1:], &cp.Rows, &cp.Columns)
+		case "hash":
+			if len(fields) != 2 {
+				err = errors.New("expected a hash")
+			} else {
+				cp.Matrix = fields[1]
+			}
+		case "chooser":
+			cp.Chooser = strings.Join(fields[1:], " ")
+		case "solutions":
+			err = parseInts(fields[1:], &cp.N)
+		case "steps":
+			err = parseInts(fields[1:], &cp.S)
+		case "path":
+			cp.Path = make([]int, len(fields)-1)
+			for i := range cp.Path {
+				if cp.Path[i], err = strconv.Atoi(fields[i+1]); err != nil {
+					break
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown field %s", fields[0])
+		}
+		if err == nil && line == 1 && fields[0] != "dlx" {
+			err = errors.New("not a dlx checkpoint")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint line %d: %s", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if line == 0 {
+		return nil, errors.New("empty checkpoint")
+	}
+	return cp, nil
+}
+
+func parseInts(fields []string, ns ...*int) error {
+	if len(fields) != len(ns) {
+		return fmt.Errorf("expected %d numbers, got %d", len(ns), len(fields))
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return err
+		}
+		*ns[i] = n
+	}
+	return nil
+}
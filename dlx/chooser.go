@@ -0,0 +1,170 @@
+package dlx
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ColumnChooser picks the primary column to branch on at each node of the
+// search, from the ones still to be covered.  It's only called when there's
+// at least one.  The order of the search and how big it is depend a lot on
+// the choice.
+// SearchParallel and Resume replay the choices of a search, so the chooser
+// has to choose the same column given the same links
+type ColumnChooser interface {
+	Choose(dl *DancingLinks) *Column
+}
+
+// SetChooser sets the rule for choosing columns.  nil is the default, MRV
+func (dl *DancingLinks) SetChooser(ch ColumnChooser) {
+	dl.chooser = ch
+}
+
+// Uncovered calls fn with each primary column still to be covered, in the
+// order of the matrix
+func (dl *DancingLinks) Uncovered(fn func(c *Column)) {
+	for col := dl.root.R; col != &dl.root.Node; col = col.R {
+		fn(col.C)
+	}
+}
+
+// Index of the column in the matrix
+func (c *Column) Index() int {
+	return c.x
+}
+
+// Size is the number of ways the search can branch on the column.  It's the
+// number of rows left in it, except for columns with bounds
+func (c *Column) Size() int {
+	if c.bounded() {
+		return c.branches()
+	}
+	return c.S
+}
+
+// MRV chooses the column with the minimum remaining values: the fewest rows
+// left to cover it, so the search branches as little as possible.  Ties go to
+// the first column in the matrix
+type MRV struct{}
+
+func (MRV) String() string {
+	return "mrv"
+}
+
+func (MRV) Choose(dl *DancingLinks) (c *Column) {
+	s := math.MaxInt32
+	for col := dl.root.R; col != &dl.root.Node; col = col.R {
+		if n := col.C.Size(); n < s {
+			c = col.C
+			s = n
+		}
+	}
+	return
+}
+
+// MRVLast is MRV with ties going to the last column in the matrix
+type MRVLast struct{}
+
+func (MRVLast) String() string {
+	return "last"
+}
+
+func (MRVLast) Choose(dl *DancingLinks) (c *Column) {
+	s := math.MaxInt32
+	for col := dl.root.R; col != &dl.root.Node; col = col.R {
+		if n := col.C.Size(); n <= s {
+			c = col.C
+			s = n
+		}
+	}
+	return
+}
+
+// MRVRandom is MRV with ties broken at random.  It can't be used with
+// SearchParallel or Resume since replaying the search chooses differently
+type MRVRandom struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func NewMRVRandom(rng *rand.Rand) *MRVRandom {
+	return &MRVRandom{rng: rng}
+}
+
+func (m *MRVRandom) String() string {
+	return "random"
+}
+
+func (m *MRVRandom) Choose(dl *DancingLinks) (c *Column) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return mrvRandom(dl, m.rng)
+}
+
+func mrvRandom(dl *DancingLinks, rng *rand.Rand) (c *Column) {
+	s := math.MaxInt32
+	ties := 0
+	for col := dl.root.R; col != &dl.root.Node; col = col.R {
+		n := col.C.Size()
+		if n < s {
+			c = col.C
+			s = n
+			ties = 1
+		} else if n == s {
+			// keep each of the tied columns with equal probability
+			ties++
+			if rng.Intn(ties) == 0 {
+				c = col.C
+			}
+		}
+	}
+	return
+}
+
+// Priority chooses by MRV among the columns with the lowest priority value,
+// so all the columns of one priority are covered before any of the next.
+// it's indexed by the columns of the matrix
+type Priority []int
+
+func (p Priority) String() string {
+	pri := make([]string, len(p))
+	for x, n := range p {
+		pri[x] = strconv.Itoa(n)
+	}
+	return "priority " + strings.Join(pri, ",")
+}
+
+func (p Priority) Choose(dl *DancingLinks) (c *Column) {
+	s, pri := math.MaxInt32, math.MaxInt32
+	for col := dl.root.R; col != &dl.root.Node; col = col.R {
+		n, x := col.C.Size(), col.C.x
+		if p[x] < pri || (p[x] == pri && n < s) {
+			c = col.C
+			s, pri = n, p[x]
+		}
+	}
+	return
+}
+
+// PreferFirst is a Priority for a matrix with w columns that covers its
+// first n columns before the rest, like the pieces of a game's coverage
+func PreferFirst(n, w int) Priority {
+	p := make(Priority, w)
+	for x := n; x < w; x++ {
+		p[x] = 1
+	}
+	return p
+}
+
+// PreferLast is a Priority for a matrix with w columns that covers the
+// columns after the first n before those, like the cells of a game's coverage
+func PreferLast(n, w int) Priority {
+	p := make(Priority, w)
+	for x := 0; x < n; x++ {
+		p[x] = 1
+	}
+	return p
+}
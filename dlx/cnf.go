@@ -0,0 +1,252 @@
+package dlx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoding of the at most one constraints of a CNF
+type Encoding int
+
+const (
+	// a clause for each pair of rows in a column.  no extra variables, but
+	// quadratic in the size of the column
+	Pairwise Encoding = iota
+	// Sinz's sequential counter, with extra variables counting the rows chosen
+	// so far down the column.  linear in the size of the column
+	Sequential
+)
+
+var ErrUnsatisfiable = errors.New("the SAT solver found no solution")
+
+// WriteCNF writes the problem in DIMACS CNF for a SAT solver.  Variable y+1
+// is true when option y is chosen.  Each primary column gets a clause that
+// one of its rows is chosen and at most one of them is, and each secondary
+// column that at most one is, counting the rows of a color as one.
+// Columns with bounds other than 1 are always counted with a sequential
+// counter, the encoding is for the columns covered at most once
+func (p *Problem) WriteCNF(w io.Writer, enc Encoding) error {
+	c := &cnf{vars: len(p.Options)}
+	rows := make([][]int, len(p.Columns))
+	colors := make([][]string, len(p.Columns))
+	for y, option := range p.Options {
+		for i, x := range option {
+			rows[x] = append(rows[x], y+1)
+			color := ""
+			if p.Colors != nil {
+				color = p.Colors[y][i]
+			}
+			colors[x] = append(colors[x], color)
+		}
+	}
+	for x := range p.Columns {
+		lo, hi := 1, 1
+		if p.isSecondary(x) {
+			lo = 0
+		} else if p.Lo != nil {
+			lo, hi = p.Lo[x], p.Hi[x]
+		}
+		lits := c.colorGroups(rows[x], colors[x])
+		if hi == 1 && enc == Pairwise {
+			c.atMostOnePairwise(lits)
+		} else {
+			c.atMost(lits, hi)
+		}
+		c.atLeast(lits, lo)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "c exact cover with %d options and %d columns\n", len(p.Options), len(p.Columns))
+	fmt.Fprintf(bw, "c variables 1 to %d are the options\n", len(p.Options))
+	fmt.Fprintf(bw, "p cnf %d %d\n", c.vars, len(c.clauses))
+	for _, clause := range c.clauses {
+		for _, lit := range clause {
+			bw.WriteString(strconv.Itoa(lit))
+			bw.WriteRune(' ')
+		}
+		bw.WriteString("0\n")
+	}
+	return bw.Flush()
+}
+
+// a CNF being built
+type cnf struct {
+	vars    int
+	clauses [][]int
+}
+
+func (c *cnf) newVar() int {
+	c.vars++
+	return c.vars
+}
+
+func (c *cnf) add(lits ...int) {
+	c.clauses = append(c.clauses, lits)
+}
+
+// the literals to count in a column: uncolored rows count on their own and
+// the rows of each color count together as a variable implied by each of them
+func (c *cnf) colorGroups(rows []int, colors []string) []int {
+	var lits []int
+	groups := make(map[string]int)
+	for i, row := range rows {
+		if colors[i] == "" {
+			lits = append(lits, row)
+			continue
+		}
+		g, ok := groups[colors[i]]
+		if !ok {
+			g = c.newVar()
+			groups[colors[i]] = g
+			lits = append(lits, g)
+		}
+		c.add(-row, g)
+	}
+	return lits
+}
+
+func (c *cnf) atMostOnePairwise(lits []int) {
+	for i := range lits {
+		for j := i + 1; j < len(lits); j++ {
+			c.add(-lits[i], -lits[j])
+		}
+	}
+}
+
+// at most k of the literals are true, with Sinz's sequential counter:
+// s[i][j] is true when more than j of the first i+1 literals are
+func (c *cnf) atMost(lits []int, k int) {
+	n := len(lits)
+	if k >= n {
+		return
+	}
+	if k == 0 {
+		for _, lit := range lits {
+			c.add(-lit)
+		}
+		return
+	}
+	s := make([][]int, n-1)
+	for i := range s {
+		s[i] = make([]int, k)
+		for j := range s[i] {
+			s[i][j] = c.newVar()
+		}
+	}
+	c.add(-lits[0], s[0][0])
+	for j := 1; j < k; j++ {
+		c.add(-s[0][j])
+	}
+	for i := 1; i < n-1; i++ {
+		c.add(-lits[i], s[i][0])
+		c.add(-s[i-1][0], s[i][0])
+		for j := 1; j < k; j++ {
+			c.add(-lits[i], -s[i-1][j-1], s[i][j])
+			c.add(-s[i-1][j], s[i][j])
+		}
+		c.add(-lits[i], -s[i-1][k-1])
+	}
+	c.add(-lits[n-1], -s[n-2][k-1])
+}
+
+// at least k of the literals are true
+func (c *cnf) atLeast(lits []int, k int) {
+	switch {
+	case k <= 0:
+	case k == 1:
+		c.add(lits...)
+	case k > len(lits):
+		c.add() // the empty clause can't be satisfied
+	default:
+		// at most n-k are false
+		neg := make([]int, len(lits))
+		for i, lit := range lits {
+			neg[i] = -lit
+		}
+		c.atMost(neg, len(lits)-k)
+	}
+}
+
+// ReadModel reads the model a SAT solver found for a CNF from WriteCNF of a
+// problem with the given number of options, and returns the chosen options.
+// It takes the "s SATISFIABLE" and "v ..." lines of the competition format as
+// well as minisat's "SAT" followed by the literals.
+// ErrUnsatisfiable is returned if the solver found no model
+func ReadModel(r io.Reader, options int) (Solution, error) {
+	soln := Solution{}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<24)
+	line := 0
+	for s.Scan() {
+		line++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || fields[0] == "c" {
+			continue
+		}
+		switch strings.Join(fields, " ") {
+		case "s UNSATISFIABLE", "UNSAT", "UNSATISFIABLE":
+			return nil, ErrUnsatisfiable
+		case "s SATISFIABLE", "SAT", "SATISFIABLE":
+			continue
+		}
+		if fields[0] == "v" {
+			fields = fields[1:]
+		}
+		for _, f := range fields {
+			lit, err := strconv.Atoi(f)
+			if err != nil {
+				return nil, fmt.Errorf("model line %d: %s", line, err)
+			}
+			if lit > 0 && lit <= options {
+				soln = append(soln, lit-1)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	sort.Ints(soln)
+	return soln, nil
+}
+
+// Verify checks that the options of the solution are an exact cover of the
+// problem: the primary columns covered within their bounds, and the secondary
+// columns at most once or by options of the same color
+func (p *Problem) Verify(soln Solution) error {
+	count := make([]int, len(p.Columns))
+	color := make([]string, len(p.Columns))
+	for _, y := range soln {
+		if y < 0 || y >= len(p.Options) {
+			return fmt.Errorf("no option %d", y)
+		}
+		for i, x := range p.Options[y] {
+			c := ""
+			if p.Colors != nil {
+				c = p.Colors[y][i]
+			}
+			if count[x] > 0 && p.isSecondary(x) && (c == "" || c != color[x]) {
+				return fmt.Errorf("column %s is covered more than once", p.Columns[x])
+			}
+			count[x]++
+			color[x] = c
+		}
+	}
+	for x, n := range count {
+		if p.isSecondary(x) {
+			continue
+		}
+		lo, hi := 1, 1
+		if p.Lo != nil {
+			lo, hi = p.Lo[x], p.Hi[x]
+		}
+		if n < lo || n > hi {
+			return fmt.Errorf("column %s is covered %d times", p.Columns[x], n)
+		}
+	}
+	return nil
+}
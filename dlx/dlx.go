@@ -2,14 +2,22 @@ package dlx
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"math"
+	"math/rand"
+	"time"
 )
 
-var debug bool
+// whether the links made by the package level constructors print what they
+// do, for the SetDebug helper
+var debugDefault bool
 
+// SetDebug makes the dancing links made from now on by New, NewSparse, Build
+// and the like print what they do, like calling Debug on each of them.
+// It sets a package default without locking, so it must not be called while
+// another goroutine is making links
 func SetDebug() {
-	debug = true
+	debugDefault = true
 }
 
 type Node struct {
@@ -17,6 +25,7 @@ type Node struct {
 	C          *Column
 	N          string
 	x, y       int
+	color      int // 0 for no color, -1 once its column is purified to its color
 }
 
 func (n *Node) String() string {
@@ -25,206 +34,578 @@ func (n *Node) String() string {
 
 type Column struct {
 	Node
-	S int
+	S         int
+	secondary bool // covered at most once instead of exactly once
+	lo, hi    int  // bounds on the number of rows covering a primary column
+	used      int  // number of chosen rows covering the column
 }
 
 // a solution is a selection of rows from the coverage matrix
 type Solution []int
 
 type DancingLinks struct {
-	root      *Column
-	o         []*Node
-	Solutions []Solution
-	max       int // max solutions to search for (0 is all)
-	nprint    int // max solutions to print
-	N, S      int // number of solutions found and steps taken
+	root *Column
+	o    []*Node
+	N, S int // number of solutions found and steps taken
+
+	ops     ops           // counts of the steps by kind
+	stats   *Stats        // stats by level when counting
+	chooser ColumnChooser // nil for MRV
+	debug   bool          // print what the search does
+	rng     *rand.Rand    // shuffles the rows of each column when set
+
+	// state of the running search
+	visit     func(Solution) bool // called with each solution.  false stops the search
+	done      <-chan struct{}     // closed when the search is cancelled
+	stop      bool
+	cancelled bool
+	walk      *walk
+	halt      *Checkpoint // where the search was cancelled
+
+	// checkpointing
+	every  time.Duration
+	saveFn func(*Checkpoint)
+	last   time.Time
+	ticks  int
+
+	// the source options are kept so parallel workers can build their own links
+	options     [][]int
+	columnNames []string
+	secondary   []bool
+	colors      [][]string
+	cols        []*Column
+	rows        []*Node // leftmost node of each matrix row
 }
 
 // given a boolean matrix, builds the corresponding dancing links cover matrix A
 // for use in DLX search algorithm
-func New(matrix [][]bool, columnNames []string, max, nprint int) *DancingLinks {
-	w, h := len(matrix[0]), len(matrix)
-	if len(columnNames) != w {
-		panic("number of column names doesn't match number of matrix columns")
+func New(matrix [][]bool, columnNames []string) *DancingLinks {
+	return NewSecondary(matrix, columnNames, nil)
+}
+
+// like New, but the columns marked in secondary are optional: they're covered
+// at most once instead of exactly once.  secondary columns are left out of
+// the header list so they're never chosen to branch on, but choosing a row
+// still covers them so no other row can use them
+func NewSecondary(matrix [][]bool, columnNames []string, secondary []bool) *DancingLinks {
+	return NewColor(matrix, columnNames, secondary, nil)
+}
+
+// like NewSecondary, but cells of secondary columns can be given a color
+// label in colors, which is indexed like the matrix.  A colored secondary
+// column may be shared by any number of chosen rows as long as they all agree
+// on its color.  An empty label means no color, so the row needs the column to
+// itself as usual.  Primary columns can't have colors.
+// This is Knuth's algorithm C, where choosing a row purifies its colored
+// columns by hiding the rows that disagree on the color
+func NewColor(matrix [][]bool, columnNames []string, secondary []bool, colors [][]string) *DancingLinks {
+	if colors != nil && len(colors) != len(matrix) {
+		panic(&MatrixError{Row: -1, Reason: "number of color rows doesn't match number of matrix rows"})
+	}
+	options := sparse(matrix, len(columnNames))
+	var optionColors [][]string
+	if colors != nil {
+		optionColors = make([][]string, len(options))
+		for y, option := range options {
+			optionColors[y] = make([]string, len(option))
+			for i, x := range option {
+				optionColors[y][i] = colors[y][x]
+			}
+		}
 	}
+	return NewSparse(options, columnNames, secondary, optionColors)
+}
+
+// converts the rows of a matrix with w columns to lists of the columns set in them
+func sparse(matrix [][]bool, w int) [][]int {
+	options := make([][]int, len(matrix))
+	for y, row := range matrix {
+		if len(row) != w {
+			panic(&MatrixError{Row: y, Reason: fmt.Sprintf("w is %d but the row's len is %d", w, len(row))})
+		}
+		for x, b := range row {
+			if b {
+				options[y] = append(options[y], x)
+			}
+		}
+	}
+	return options
+}
+
+// like NewColor, but the rows of the matrix are given as options: lists of
+// the indices of the columns each row covers.  This saves building a dense
+// matrix when the rows only cover a few of the columns.  colors is indexed
+// like options, so colors[y][i] is the color of column options[y][i]
+func NewSparse(options [][]int, columnNames []string, secondary []bool, colors [][]string) *DancingLinks {
+	if err := checkOptions(options, columnNames, secondary, colors); err != nil {
+		panic(err)
+	}
+	return newSparse(options, columnNames, secondary, colors, debugDefault)
+}
+
+// NewSparse without checking the options, printing what it does if debug is set
+func newSparse(options [][]int, columnNames []string, secondary []bool, colors [][]string, debug bool) *DancingLinks {
+	w, h := len(columnNames), len(options)
+	colorIDs := make(map[string]int)
 
 	root := &Column{Node: Node{N: "root"}, S: 0}
 	root.C = root
 	var cols []*Column
-	var links []*Node // this is to carry forward the "last link" node
 
-	// build the L/R columns row
+	// build the L/R columns row.  only primary columns go in the header list,
+	// secondary columns link to themselves
+	last := &root.Node
 	for x := 0; x < w; x++ {
-		cols = append(cols, &Column{Node: Node{N: columnNames[x]}, S: 0})
+		cols = append(cols, &Column{Node: Node{N: columnNames[x]}, S: 0, lo: 1, hi: 1})
 		cols[x].C = cols[x]
-		// link the previous col to this one
-		if x == 0 {
-			cols[x].L = &root.Node
-			root.R = &cols[x].Node
+		cols[x].x = x
+		cols[x].U = &cols[x].Node
+		cols[x].D = &cols[x].Node
+		if secondary != nil && secondary[x] {
+			cols[x].secondary = true
+			cols[x].L = &cols[x].Node
+			cols[x].R = &cols[x].Node
 		} else {
-			cols[x].L = &cols[x-1].Node
-			cols[x-1].R = &cols[x].Node
+			// link the previous col to this one
+			cols[x].L = last
+			last.R = &cols[x].Node
+			last = &cols[x].Node
 		}
-		links = append(links, &cols[x].Node)
 	}
 	// comlpete the L/R circular links
-	cols[len(cols)-1].R = &root.Node
-	root.L = &cols[len(cols)-1].Node
-
-	// build the nodes top to bottom and do U/D linking
-	sizes := make([]int, w, w)
-	var nodes [][]*Node // this is to complete lnking of L/R
-	for y := range matrix {
-		var row []*Node
-		for x := range matrix[y] {
-			if len(matrix[y]) != w {
-				panic(fmt.Sprintf("bad matrix: w is %d but row %d len is %d", w, y, len(matrix[y])))
-			}
-			if !matrix[y][x] {
-				row = append(row, nil)
-				continue
-			}
+	last.R = &root.Node
+	root.L = last
+
+	// add the nodes of each row to the bottom of their columns and link them
+	// around the row in the order given
+	rows := make([]*Node, h, h)
+	for y, option := range options {
+		var first *Node
+		for i, x := range option {
+			c := cols[x]
 			node := &Node{
-				C: cols[x],
+				C: c,
 				x: x,
 				y: y,
-				N: fmt.Sprintf("n(%s,%d)", cols[x].String(), y),
+				N: fmt.Sprintf("n(%s,%d)", c.String(), y),
+			}
+			if colors != nil && colors[y][i] != "" {
+				if _, ok := colorIDs[colors[y][i]]; !ok {
+					colorIDs[colors[y][i]] = len(colorIDs) + 1
+				}
+				node.color = colorIDs[colors[y][i]]
+				node.N = fmt.Sprintf("n(%s,%d):%s", c.String(), y, colors[y][i])
+			}
+			node.U = c.U
+			node.D = &c.Node
+			c.U.D = node
+			c.U = node
+			c.S += 1
+			if first == nil {
+				first = node
+				node.L, node.R = node, node
+			} else {
+				node.L = first.L
+				node.R = first
+				first.L.R = node
+				first.L = node
 			}
-			links[x].D = node
-			node.U = links[x]
-			links[x] = node
-			sizes[x] += 1
-			row = append(row, node)
 		}
-		nodes = append(nodes, row)
+		rows[y] = first
 	}
-	// comlpete the U/D circular links
-	// and mark the sizes
-	for x := 0; x < w; x++ {
-		links[x].D = &cols[x].Node
-		cols[x].U = links[x]
-		cols[x].S = sizes[x]
+
+	dl := &DancingLinks{
+		root:        root,
+		options:     options,
+		columnNames: columnNames,
+		secondary:   secondary,
+		colors:      colors,
+		cols:        cols,
+		rows:        rows,
+		debug:       debug,
+	}
+	if dl.debug {
+		fmt.Println(dl)
 	}
+	return dl
+}
 
-	// to complete the L/R links for nodes, we build a fake column that acts as a header
-	rowh := make([]*Node, 0, 0)
-	links = make([]*Node, 0, 0)
-	for y := 0; y < h; y++ {
-		node := &Node{}
-		rowh = append(rowh, node)
-		links = append(links, node)
+// Debug turns printing what the search does on or off.  Turning it on
+// prints the links first, like links made after SetDebug
+func (dl *DancingLinks) Debug(on bool) {
+	if on && !dl.debug {
+		fmt.Println(dl)
 	}
+	dl.debug = on
+}
 
-	// link the L/R nodes left to right
-	for x := 0; x < w; x++ {
-		for y := 0; y < h; y++ {
-			node := nodes[y][x]
-			if node == nil {
-				continue
-			}
-			links[y].R = node
-			node.L = links[y]
-			links[y] = node
+// MatrixError is a coverage matrix that can't be made into dancing links.
+// Row is the row, or option, that's bad, or -1 if it's not about one row
+type MatrixError struct {
+	Row    int
+	Reason string
+}
+
+func (e *MatrixError) Error() string {
+	if e.Row < 0 {
+		return "bad matrix: " + e.Reason
+	}
+	return fmt.Sprintf("bad option %d: %s", e.Row, e.Reason)
+}
+
+// Build is NewSparse, but returns a *MatrixError for bad options instead of
+// panicking
+func Build(options [][]int, columnNames []string, secondary []bool, colors [][]string) (*DancingLinks, error) {
+	if err := checkOptions(options, columnNames, secondary, colors); err != nil {
+		return nil, err
+	}
+	return newSparse(options, columnNames, secondary, colors, debugDefault), nil
+}
+
+// BuildDense is New, but returns a *MatrixError for a bad matrix instead of
+// panicking
+func BuildDense(matrix [][]bool, columnNames []string) (*DancingLinks, error) {
+	for y, row := range matrix {
+		if len(row) != len(columnNames) {
+			return nil, &MatrixError{Row: y, Reason: fmt.Sprintf("w is %d but the row's len is %d", len(columnNames), len(row))}
 		}
 	}
-	// complete circular L/R links and delete rowh nodes
-	for y := 0; y < h; y++ {
-		rowh[y].R.L = links[y]
-		links[y].R = rowh[y].R
-		rowh[y].R = nil
-		rowh[y].L = nil
+	return New(matrix, columnNames), nil
+}
+
+// checks the options given to NewSparse
+func checkOptions(options [][]int, columnNames []string, secondary []bool, colors [][]string) error {
+	w := len(columnNames)
+	if secondary != nil && len(secondary) != w {
+		return &MatrixError{Row: -1, Reason: "number of secondary flags doesn't match number of matrix columns"}
+	}
+	if colors != nil && len(colors) != len(options) {
+		return &MatrixError{Row: -1, Reason: "number of color rows doesn't match number of options"}
+	}
+	seen := make([]int, w) // the last row + 1 to cover each column
+	for y, option := range options {
+		if colors != nil && len(colors[y]) != len(option) {
+			return &MatrixError{Row: y, Reason: "number of colors doesn't match its columns"}
+		}
+		for i, x := range option {
+			if x < 0 || x >= w {
+				return &MatrixError{Row: y, Reason: fmt.Sprintf("column %d out of range", x)}
+			}
+			if seen[x] == y+1 {
+				return &MatrixError{Row: y, Reason: fmt.Sprintf("column %s repeated", columnNames[x])}
+			}
+			seen[x] = y + 1
+			if colors != nil && colors[y][i] != "" && (secondary == nil || !secondary[x]) {
+				return &MatrixError{Row: y, Reason: fmt.Sprintf("primary column %s can't have color %s", columnNames[x], colors[y][i])}
+			}
+		}
 	}
+	return nil
+}
 
-	dl := &DancingLinks{root: root, max: max, nprint: nprint}
-	if debug {
-		fmt.Println(dl)
+// Search runs the DLX algorithm to find all exact covers of the coverage matrix.
+// fn is called with each solution in the order found and may be nil to only
+// count them.  The search stops when fn returns false or when ctx is cancelled,
+// in which case the context's error is returned.  Either way, the links are
+// restored and N and S count the solutions and steps up to that point.
+func (dl *DancingLinks) Search(ctx context.Context, fn func(Solution) bool) error {
+	dl.N, dl.S = 0, 0
+	dl.o = dl.o[:0]
+	dl.start(ctx, fn)
+	dl.search(0)
+	if dl.cancelled {
+		return ctx.Err()
 	}
-	return dl
+	return nil
+}
+
+func (dl *DancingLinks) start(ctx context.Context, fn func(Solution) bool) {
+	dl.visit = fn
+	dl.done = ctx.Done()
+	dl.stop, dl.cancelled = false, false
+	dl.halt = nil
+	dl.last = time.Now()
 }
 
 // DLX search(k) algorithm
-// finds all exact covers of a coverage matrix
-func (dl *DancingLinks) Search(k int) {
-	if debug {
+func (dl *DancingLinks) search(k int) {
+	if dl.stats != nil {
+		dl.countNode(k)
+		return
+	}
+	dl.searchNode(k)
+}
+
+// the node of the search tree at level k
+func (dl *DancingLinks) searchNode(k int) {
+	if dl.walk != nil && dl.walk.enter(dl, k) {
+		return
+	}
+	if dl.debug {
 		fmt.Printf("k is %d\n", k)
 	}
 	dl.S++
 	if dl.root.R == &dl.root.Node {
-		dl.recordSolution()
+		dl.recordSolution(k)
 		return
 	}
-	if dl.max > 0 && dl.N >= dl.max {
+	select {
+	case <-dl.done:
+		dl.stop, dl.cancelled = true, true
+		dl.halt = dl.checkpoint(k)
 		return
+	default:
+	}
+	if dl.every > 0 {
+		dl.tick(k)
+	}
+	if len(dl.o) <= k {
+		dl.o = append(dl.o, nil)
 	}
-	dl.o = append(dl.o, nil)
 
 	c := dl.chooseColumn()
+	if dl.stats != nil {
+		dl.stats.choose(k, c)
+	}
+	if dl.rng != nil {
+		dl.searchShuffled(k, c)
+		return
+	}
+	if c.bounded() {
+		dl.searchBounded(k, c)
+		return
+	}
+	replay, y := dl.replaying(k)
 	dl.cover(c)
-	for r := c.D; r != &c.Node; r = r.D {
-		dl.o[k] = r
-		for j := r.R; j != r; j = j.R {
-			dl.cover(j.C)
+	for r := c.D; r != &c.Node && !dl.stop; r = r.D {
+		if replay && r.y != y {
+			continue
 		}
-		dl.Search(k + 1)
+		dl.o[k] = r
+		dl.commitRow(r)
+		dl.search(k + 1)
 		r = dl.o[k]
 		c = r.C
-		for j := r.L; j != r; j = j.L {
-			dl.uncover(j.C)
+		dl.uncommitRow(r)
+		if replay {
+			replay = false
+			if dl.walk.replayed(k) {
+				break
+			}
 		}
 	}
+	if replay {
+		dl.walk.lost = true
+	}
 	dl.uncover(c)
 }
 
-// method with heuristic that minimizes branching
+// walk restricts a search to part of the search tree.  the top levels are
+// replayed along path, the row chosen at each level (-1 when no row is chosen),
+// skipping the branches before it.  with only set, the search stops after the
+// subtree at the end of path, otherwise it carries on from there.  with resume
+// set, N and S are set to n and s at the end of path so the steps of the
+// replay aren't counted.  with split set, the subtrees at depth aren't searched
+// and their paths are collected
+type walk struct {
+	path     []int
+	only     bool
+	s        int // steps taken in the subtree at the end of path when only is set
+	resume   bool
+	n        int
+	split    bool
+	depth    int
+	branches [][]int
+	lost     bool // a row on the path wasn't found
+}
+
+// called on entering search(k).  returns true if the walk took care of it
+func (w *walk) enter(dl *DancingLinks, k int) bool {
+	if w.split && (k == w.depth || dl.root.R == &dl.root.Node) {
+		w.branches = append(w.branches, dl.path(k))
+		return true
+	}
+	if w.only && k == len(w.path) {
+		// search the subtree normally and count its steps
+		s := dl.S
+		dl.walk = nil
+		dl.search(k)
+		dl.walk = w
+		w.s = dl.S - s
+		return true
+	}
+	if w.resume && k == len(w.path) {
+		dl.N, dl.S = w.n, w.s
+		w.resume = false
+	}
+	return false
+}
+
+// called after the branch on the path at level k is searched.  the rest of
+// the path is done with.  returns true if the search should stop at this level
+func (w *walk) replayed(k int) bool {
+	w.path = w.path[:k]
+	return w.only
+}
+
+// returns if level k is being replayed and the row to choose there
+func (dl *DancingLinks) replaying(k int) (bool, int) {
+	if dl.walk == nil || k >= len(dl.walk.path) {
+		return false, 0
+	}
+	return true, dl.walk.path[k]
+}
+
+// returns the rows chosen at the first k levels of the search, -1 where none was
+func (dl *DancingLinks) path(k int) []int {
+	path := make([]int, k, k)
+	for i, o := range dl.o[:k] {
+		path[i] = -1
+		if o != nil {
+			path[i] = o.y
+		}
+	}
+	return path
+}
+
+// chooses the column to branch on.  by default, the one with the fewest
+// rows, which minimizes branching
 func (dl *DancingLinks) chooseColumn() (c *Column) {
 	dl.S++
-	s := math.MaxInt32
-	for col := dl.root.R; col != &dl.root.Node; col = col.R {
-		if col.C.S < s {
-			c = col.C
-			s = col.C.S
-		}
+	if dl.chooser != nil {
+		c = dl.chooser.Choose(dl)
+	} else if dl.rng != nil {
+		c = mrvRandom(dl, dl.rng)
+	} else {
+		c = MRV{}.Choose(dl)
 	}
-	if debug {
+	if dl.debug {
 		fmt.Printf("column choice is %s\n", c)
 	}
 	return
 }
 
 // cover: unlinks c from header list and remove all rows in c's own list from other column lists they are in
+// secondary columns link to themselves, so unlinking them from the header is a noop
 func (dl *DancingLinks) cover(c *Column) {
 	dl.S++
-	if debug {
+	dl.ops.covers++
+	if dl.debug {
 		fmt.Printf("covering %s\n", c)
 	}
 	c.R.L = c.L
 	c.L.R = c.R
 	for i := c.D; i != &c.Node; i = i.D {
-		for j := i.R; j != i; j = j.R {
-			j.D.U = j.U
-			j.U.D = j.D
-			j.C.S -= 1
-		}
+		dl.hide(i)
 	}
 }
 
 // uncover: inverse of cover. the meat of the dancing links
 func (dl *DancingLinks) uncover(c *Column) {
 	dl.S++
-	if debug {
+	dl.ops.uncovers++
+	if dl.debug {
 		fmt.Printf("uncovering %s\n", c)
 	}
 	for i := c.U; i != &c.Node; i = i.U {
-		for j := i.L; j != i; j = j.L {
-			j.C.S += 1
-			j.D.U = j
-			j.U.D = j
-		}
+		dl.unhide(i)
 	}
 	c.R.L = &c.Node
 	c.L.R = &c.Node
 }
 
+// hide: removes the row of node i from the other column lists it's in.
+// nodes in purified columns are left alone, their columns are never searched
+func (dl *DancingLinks) hide(i *Node) {
+	for j := i.R; j != i; j = j.R {
+		if j.color < 0 {
+			continue
+		}
+		j.D.U = j.U
+		j.U.D = j.D
+		j.C.S -= 1
+		dl.ops.updates++
+	}
+}
+
+// unhide: inverse of hide
+func (dl *DancingLinks) unhide(i *Node) {
+	for j := i.L; j != i; j = j.L {
+		if j.color < 0 {
+			continue
+		}
+		j.C.S += 1
+		j.D.U = j
+		j.U.D = j
+	}
+}
+
+// after choosing row r, covers the other columns in r.  colored columns are
+// purified instead so rows with the same color can still share them, and
+// bounded columns are only covered once they're used up
+func (dl *DancingLinks) commitRow(r *Node) {
+	for j := r.R; j != r; j = j.R {
+		if j.C.bounded() {
+			dl.use(j.C)
+		} else if j.color == 0 {
+			dl.cover(j.C)
+		} else if j.color > 0 {
+			dl.purify(j)
+		}
+	}
+}
+
+// inverse of commitRow
+func (dl *DancingLinks) uncommitRow(r *Node) {
+	for j := r.L; j != r; j = j.L {
+		if j.C.bounded() {
+			dl.unuse(j.C)
+		} else if j.color == 0 {
+			dl.uncover(j.C)
+		} else if j.color > 0 {
+			dl.unpurify(j)
+		}
+	}
+}
+
+// purify: hides the rows in the column of node p that don't have p's color.
+// the rows that do are marked with color -1 so they don't purify it again.
+// p's own row was hidden when its primary column was covered, so p keeps its color
+func (dl *DancingLinks) purify(p *Node) {
+	dl.S++
+	dl.ops.purifies++
+	c := p.C
+	color := p.color
+	if dl.debug {
+		fmt.Printf("purifying %s\n", p)
+	}
+	for i := c.D; i != &c.Node; i = i.D {
+		if i.color == color {
+			i.color = -1
+		} else {
+			dl.hide(i)
+		}
+	}
+}
+
+// unpurify: inverse of purify
+func (dl *DancingLinks) unpurify(p *Node) {
+	dl.S++
+	dl.ops.unpurifies++
+	c := p.C
+	color := p.color
+	if dl.debug {
+		fmt.Printf("unpurifying %s\n", p)
+	}
+	for i := c.U; i != &c.Node; i = i.U {
+		if i.color < 0 {
+			i.color = color
+		} else {
+			dl.unhide(i)
+		}
+	}
+}
+
 func (dl *DancingLinks) String() string {
 	var s bytes.Buffer
 	s.WriteString("Columns:\n")
@@ -250,15 +631,15 @@ func (dl *DancingLinks) String() string {
 	return s.String()
 }
 
-func (dl *DancingLinks) recordSolution() {
-	if debug {
+func (dl *DancingLinks) recordSolution(k int) {
+	if dl.debug {
 		var buf bytes.Buffer
 		buf.WriteString("========\n")
 		buf.WriteString("solution\n")
 		buf.WriteString("========\n")
-		for _, o := range dl.o {
+		for _, o := range dl.o[:k] {
 			if o == nil {
-				break
+				continue
 			}
 			//
 			// print the row that includes node o
@@ -271,18 +652,16 @@ func (dl *DancingLinks) recordSolution() {
 		fmt.Println(buf.String())
 	}
 	dl.N++
-	if dl.N%1000 == 0 {
-		fmt.Printf("\rfound %d solutions", dl.N)
-	}
-	if dl.N > dl.nprint {
+	if dl.visit == nil {
 		return
 	}
-	soln := Solution{}
-	for _, o := range dl.o {
-		if o == nil {
-			break
+	soln := make(Solution, 0, k)
+	for _, o := range dl.o[:k] {
+		if o != nil {
+			soln = append(soln, o.y)
 		}
-		soln = append(soln, o.y)
 	}
-	dl.Solutions = append(dl.Solutions, soln)
+	if !dl.visit(soln) {
+		dl.stop = true
+	}
 }
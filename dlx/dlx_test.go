@@ -0,0 +1,937 @@
+package dlx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// the example matrix from Knuth's paper
+func knuthMatrix() ([][]bool, []string) {
+	rows := []string{
+		"0010110",
+		"1001001",
+		"0110010",
+		"1001000",
+		"0100001",
+		"0001101",
+	}
+	var matrix [][]bool
+	for _, row := range rows {
+		var r []bool
+		for _, c := range row {
+			r = append(r, c == '1')
+		}
+		matrix = append(matrix, r)
+	}
+	return matrix, []string{"A", "B", "C", "D", "E", "F", "G"}
+}
+
+// domino tilings of a w x h board.  columns are the cells
+func dominoMatrix(w, h int) ([][]bool, []string) {
+	var (
+		matrix [][]bool
+		names  []string
+	)
+	for i := 0; i < w*h; i++ {
+		names = append(names, fmt.Sprintf("c%d", i))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x+1 < w {
+				row := make([]bool, w*h)
+				row[y*w+x], row[y*w+x+1] = true, true
+				matrix = append(matrix, row)
+			}
+			if y+1 < h {
+				row := make([]bool, w*h)
+				row[y*w+x], row[(y+1)*w+x] = true, true
+				matrix = append(matrix, row)
+			}
+		}
+	}
+	return matrix, names
+}
+
+// collects up to n solutions
+func collect(solutions *[]Solution, n int) func(Solution) bool {
+	return func(soln Solution) bool {
+		*solutions = append(*solutions, soln)
+		return n == 0 || len(*solutions) < n
+	}
+}
+
+func TestSearch(t *testing.T) {
+	matrix, names := knuthMatrix()
+	dl := New(matrix, names)
+	var solutions []Solution
+	if err := dl.Search(context.Background(), collect(&solutions, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if dl.N != 1 || len(solutions) != 1 {
+		t.Fatalf("expected 1 solution, got %d", dl.N)
+	}
+	soln := append(Solution{}, solutions[0]...)
+	sort.Ints(soln)
+	if !reflect.DeepEqual(soln, Solution{0, 3, 4}) {
+		t.Fatalf("expected rows [0 3 4], got %v", soln)
+	}
+}
+
+func TestSearchStop(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	dl := New(matrix, names)
+	var solutions []Solution
+	if err := dl.Search(context.Background(), collect(&solutions, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if dl.N != 5 || len(solutions) != 5 {
+		t.Fatalf("expected search to stop at 5 solutions, got %d", dl.N)
+	}
+	// the links must be restored so a second search finds everything
+	if err := dl.Search(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if dl.N != 36 {
+		t.Fatalf("expected 36 domino tilings of 4x4 after a stopped search, got %d", dl.N)
+	}
+}
+
+func TestSearchCancel(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	dl := New(matrix, names)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := dl.Search(ctx, func(Solution) bool {
+		cancel()
+		return true
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if dl.N >= 36 {
+		t.Fatalf("expected cancelled search to stop early, got %d solutions", dl.N)
+	}
+	err = dl.SearchParallel(ctx, 2, 2, nil)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled from parallel search, got %v", err)
+	}
+}
+
+func TestSearchParallel(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	serial := New(matrix, names)
+	var expect []Solution
+	serial.Search(context.Background(), collect(&expect, 0))
+	if serial.N != 36 {
+		t.Fatalf("expected 36 domino tilings of 4x4, got %d", serial.N)
+	}
+	for _, depth := range []int{1, 2, 3, 20} {
+		for _, workers := range []int{1, 3} {
+			dl := New(matrix, names)
+			var solutions []Solution
+			dl.SearchParallel(context.Background(), workers, depth, collect(&solutions, 0))
+			if dl.N != serial.N || dl.S != serial.S {
+				t.Errorf("depth %d, %d workers: got N=%d S=%d, expected N=%d S=%d", depth, workers, dl.N, dl.S, serial.N, serial.S)
+			}
+			if !reflect.DeepEqual(solutions, expect) {
+				t.Errorf("depth %d, %d workers: solutions differ from serial search", depth, workers)
+			}
+		}
+	}
+	// stopping early gives the first solutions of the serial search
+	dl := New(matrix, names)
+	var solutions []Solution
+	dl.SearchParallel(context.Background(), 3, 2, collect(&solutions, 7))
+	if dl.N != 7 || !reflect.DeepEqual(solutions, expect[:7]) {
+		t.Errorf("expected the first 7 serial solutions, got %d", dl.N)
+	}
+	// more solutions in a subtree than the workers buffer ahead of the merge
+	matrix, names = dominoMatrix(6, 6)
+	serial = New(matrix, names)
+	expect = nil
+	serial.Search(context.Background(), collect(&expect, 0))
+	dl = New(matrix, names)
+	solutions = nil
+	dl.SearchParallel(context.Background(), 4, 3, collect(&solutions, 0))
+	if dl.N != 6728 || dl.S != serial.S || !reflect.DeepEqual(solutions, expect) {
+		t.Errorf("expected the 6728 serial tilings of 6x6, got N=%d S=%d", dl.N, dl.S)
+	}
+}
+
+func TestSecondary(t *testing.T) {
+	matrix := [][]bool{
+		{true, false, true},
+		{false, true, true},
+		{true, false, false},
+		{false, true, false},
+	}
+	names := []string{"A", "B", "x"}
+	dl := New(matrix, names)
+	dl.Search(context.Background(), nil)
+	if dl.N != 2 {
+		t.Errorf("expected 2 solutions with x primary, got %d", dl.N)
+	}
+	dl = NewSecondary(matrix, names, []bool{false, false, true})
+	var solutions []Solution
+	dl.Search(context.Background(), collect(&solutions, 0))
+	if dl.N != 3 {
+		t.Fatalf("expected 3 solutions with x secondary, got %d", dl.N)
+	}
+	for _, soln := range solutions {
+		sort.Ints(soln)
+	}
+	expect := []Solution{{0, 3}, {1, 2}, {2, 3}}
+	sort.Slice(solutions, func(i, j int) bool { return solutions[i][0]*10+solutions[i][1] < solutions[j][0]*10+solutions[j][1] })
+	if !reflect.DeepEqual(solutions, expect) {
+		t.Errorf("expected %v, got %v", expect, solutions)
+	}
+}
+
+// the colored exact cover example from Knuth's TAOCP 7.2.2.1
+func TestColor(t *testing.T) {
+	matrix := [][]bool{
+		{true, true, false, true, true},
+		{true, false, true, true, true},
+		{true, false, false, true, false},
+		{false, true, false, true, false},
+		{false, false, true, false, true},
+	}
+	colors := [][]string{
+		{"", "", "", "", "A"},
+		{"", "", "", "A", ""},
+		{"", "", "", "B", ""},
+		{"", "", "", "A", ""},
+		{"", "", "", "", "B"},
+	}
+	names := []string{"p", "q", "r", "x", "y"}
+	secondary := []bool{false, false, false, true, true}
+	dl := NewColor(matrix, names, secondary, colors)
+	var solutions []Solution
+	dl.Search(context.Background(), collect(&solutions, 0))
+	if dl.N != 1 {
+		t.Fatalf("expected 1 solution, got %d", dl.N)
+	}
+	soln := solutions[0]
+	sort.Ints(soln)
+	if !reflect.DeepEqual(soln, Solution{1, 3}) {
+		t.Fatalf("expected rows [1 3], got %v", soln)
+	}
+	// the links and colors must be restored after the search
+	dl.SearchParallel(context.Background(), 2, 2, nil)
+	if dl.N != 1 {
+		t.Fatalf("expected 1 solution on a second search, got %d", dl.N)
+	}
+}
+
+func TestColorPrimary(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic for a colored primary column")
+		}
+	}()
+	NewColor([][]bool{{true}}, []string{"p"}, nil, [][]string{{"A"}})
+}
+
+func TestBuild(t *testing.T) {
+	names := []string{"p", "x"}
+	secondary := []bool{false, true}
+	for _, c := range []struct {
+		options [][]int
+		colors  [][]string
+		row     int
+	}{
+		{[][]int{{0}, {0, 2}}, nil, 1},
+		{[][]int{{0, 0}}, nil, 0},
+		{[][]int{{0, 1}}, [][]string{{"A", ""}}, 0},
+		{[][]int{{0, 1}}, [][]string{{"", "A"}, {""}}, -1},
+	} {
+		_, err := Build(c.options, names, secondary, c.colors)
+		var bad *MatrixError
+		if !errors.As(err, &bad) || bad.Row != c.row {
+			t.Errorf("expected a matrix error for row %d of %v, got %v", c.row, c.options, err)
+		}
+	}
+	if _, err := Build([][]int{{0, 1}}, names, secondary, [][]string{{"", "A"}}); err != nil {
+		t.Errorf("expected good options to build, got %v", err)
+	}
+	if _, err := BuildDense([][]bool{{true}}, names); err == nil {
+		t.Errorf("expected an error for a short matrix row")
+	}
+}
+
+func TestBounds(t *testing.T) {
+	// choose 2 or 3 of the rows covering A, each with its own B column
+	matrix := [][]bool{
+		{true, true, false, false, false},
+		{true, false, true, false, false},
+		{true, false, false, true, false},
+		{true, false, false, false, true},
+	}
+	names := []string{"A", "B1", "B2", "B3", "B4"}
+	secondary := []bool{false, true, true, true, true}
+	dl := NewSecondary(matrix, names, secondary)
+	if err := dl.SetBounds(0, 2, 3); err != nil {
+		t.Fatal(err)
+	}
+	var bad *MatrixError
+	if err := dl.SetBounds(1, 0, 1); !errors.As(err, &bad) {
+		t.Errorf("expected a *MatrixError for bounds on a secondary column, got %v", err)
+	}
+	if err := dl.SetBounds(0, 2, 1); !errors.As(err, &bad) {
+		t.Errorf("expected a *MatrixError for bounds out of order, got %v", err)
+	}
+	var solutions []Solution
+	dl.Search(context.Background(), collect(&solutions, 0))
+	// 4 choose 2 + 4 choose 3, with no duplicates
+	if dl.N != 10 {
+		t.Fatalf("expected 10 solutions, got %d", dl.N)
+	}
+	seen := make(map[string]bool)
+	for _, soln := range solutions {
+		sort.Ints(soln)
+		key := fmt.Sprint(soln)
+		if seen[key] {
+			t.Errorf("duplicate solution %v", soln)
+		}
+		seen[key] = true
+	}
+	serial := dl.S
+	dl.SearchParallel(context.Background(), 2, 2, nil)
+	if dl.N != 10 || dl.S != serial {
+		t.Errorf("expected parallel search to find 10 solutions in %d steps, got %d in %d", serial, dl.N, dl.S)
+	}
+	// every branch, including the ones choosing no row, leads to a node
+	stats, _ := dl.Count(context.Background())
+	if sum(stats.Branches) != stats.TotalNodes()-1 {
+		t.Errorf("expected %d branches, got %d", stats.TotalNodes()-1, sum(stats.Branches))
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	dl := New(matrix, names)
+	dl.Search(context.Background(), nil)
+	steps := float64(dl.S)
+	e := dl.Estimate(20000, rand.New(rand.NewSource(1)))
+	if e.Solutions < 36*0.9 || e.Solutions > 36*1.1 {
+		t.Errorf("expected an estimate near 36 solutions, got %f", e.Solutions)
+	}
+	if e.Steps < steps*0.8 || e.Steps > steps*1.2 {
+		t.Errorf("expected an estimate near %f steps, got %f", steps, e.Steps)
+	}
+	// probing must leave the links as they were
+	dl.Search(context.Background(), nil)
+	if dl.N != 36 {
+		t.Errorf("expected 36 solutions after estimating, got %d", dl.N)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	dl := New(matrix, names)
+	var expect []Solution
+	dl.Search(context.Background(), collect(&expect, 0))
+	order := func(seed int64) []Solution {
+		var solutions []Solution
+		dl.SetRandom(rand.New(rand.NewSource(seed)))
+		dl.Search(context.Background(), collect(&solutions, 0))
+		dl.SetRandom(nil)
+		return solutions
+	}
+	first, again, other := order(1), order(1), order(2)
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("expected the same order from the same seed")
+	}
+	if reflect.DeepEqual(first, other) {
+		t.Errorf("expected another order from another seed")
+	}
+	if !reflect.DeepEqual(sortSolutions(first), sortSolutions(expect)) {
+		t.Errorf("expected the same solutions in a random order")
+	}
+
+	// each combination of rows of a bounded column is still found once
+	matrix = [][]bool{
+		{true, true, false, false, false},
+		{true, false, true, false, false},
+		{true, false, false, true, false},
+		{true, false, false, false, true},
+	}
+	bounded := NewSecondary(matrix, []string{"A", "B1", "B2", "B3", "B4"}, []bool{false, true, true, true, true})
+	bounded.SetBounds(0, 2, 3)
+	var solutions []Solution
+	bounded.SetRandom(rand.New(rand.NewSource(1)))
+	bounded.Search(context.Background(), collect(&solutions, 0))
+	if len(solutions) != 10 {
+		t.Errorf("expected 10 solutions with bounds, got %d", len(solutions))
+	}
+	seen := make(map[string]bool)
+	for _, soln := range sortSolutions(solutions) {
+		if seen[fmt.Sprint(soln)] {
+			t.Errorf("duplicate solution %v", soln)
+		}
+		seen[fmt.Sprint(soln)] = true
+	}
+
+	if soln := dl.RandomSolution(rand.New(rand.NewSource(3))); len(soln) != 8 {
+		t.Errorf("expected a random tiling, got %v", soln)
+	}
+
+	// the 36 tilings are sampled about evenly
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < 3600; i++ {
+		soln := dl.Sample(100, rng)
+		sort.Ints(soln)
+		counts[fmt.Sprint(soln)]++
+	}
+	if len(counts) != 36 {
+		t.Errorf("expected all 36 tilings to be sampled, got %d", len(counts))
+	}
+	for soln, n := range counts {
+		if n < 60 || n > 140 {
+			t.Errorf("expected tiling %s about 100 times, got %d", soln, n)
+		}
+	}
+	dl.Search(context.Background(), nil)
+	if dl.N != 36 {
+		t.Errorf("expected 36 solutions after sampling, got %d", dl.N)
+	}
+}
+
+// the solutions with their rows sorted, in order
+func sortSolutions(solutions []Solution) []string {
+	var s []string
+	for _, soln := range solutions {
+		soln = append(Solution{}, soln...)
+		sort.Ints(soln)
+		s = append(s, fmt.Sprint(soln))
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestResume(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	serial := New(matrix, names)
+	var expect []Solution
+	serial.Search(context.Background(), collect(&expect, 0))
+
+	for m := 1; m < len(expect); m += 5 {
+		dl := New(matrix, names)
+		ctx, cancel := context.WithCancel(context.Background())
+		var solutions []Solution
+		err := dl.Search(ctx, func(soln Solution) bool {
+			solutions = append(solutions, soln)
+			if len(solutions) == m {
+				cancel()
+			}
+			return true
+		})
+		if err != context.Canceled || dl.Halted() == nil {
+			t.Fatalf("expected search to be cancelled after %d solutions, got %v", m, err)
+		}
+		// round trip the checkpoint through its file format
+		var b bytes.Buffer
+		if err := dl.Halted().Write(&b); err != nil {
+			t.Fatal(err)
+		}
+		cp, err := ReadCheckpoint(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cp, dl.Halted()) {
+			t.Fatalf("expected checkpoint %v after reading it back, got %v", dl.Halted(), cp)
+		}
+
+		dl = New(matrix, names)
+		if err := dl.Resume(context.Background(), cp, collect(&solutions, 0)); err != nil {
+			t.Fatal(err)
+		}
+		if dl.N != serial.N || dl.S != serial.S {
+			t.Errorf("resumed after %d: got N=%d S=%d, expected N=%d S=%d", m, dl.N, dl.S, serial.N, serial.S)
+		}
+		if !reflect.DeepEqual(solutions, expect) {
+			t.Errorf("resumed after %d: solutions differ from an uninterrupted search", m)
+		}
+	}
+
+	// a checkpoint from another matrix or another chooser doesn't resume
+	dl := New(matrix, names)
+	ctx, cancel := context.WithCancel(context.Background())
+	dl.Search(ctx, func(Solution) bool {
+		cancel()
+		return true
+	})
+	halted := dl.Halted()
+	cp := *halted
+	cp.Path = []int{1000}
+	if err := New(matrix, names).Resume(context.Background(), &cp, nil); err != ErrCheckpoint {
+		t.Errorf("expected ErrCheckpoint for a bad path, got %v", err)
+	}
+	swapped := append([][]bool{matrix[1], matrix[0]}, matrix[2:]...)
+	if err := New(swapped, names).Resume(context.Background(), halted, nil); err != ErrCheckpoint {
+		t.Errorf("expected ErrCheckpoint for a matrix of the same size, got %v", err)
+	}
+	dl = New(matrix, names)
+	dl.SetChooser(MRVLast{})
+	if err := dl.Resume(context.Background(), halted, nil); err != ErrChooser {
+		t.Errorf("expected ErrChooser for another chooser, got %v", err)
+	}
+}
+
+func TestCount(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	dl := New(matrix, names)
+	stats, err := dl.Count(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Solutions != 36 || dl.N != 36 {
+		t.Fatalf("expected 36 solutions, got %d", stats.Solutions)
+	}
+	// every tiling uses 8 dominoes, so the solutions are the nodes at level 8
+	if len(stats.Nodes) != 9 || stats.Nodes[0] != 1 || stats.Nodes[8] != 36 {
+		t.Errorf("expected 1 root node and 36 nodes at level 8, got %v", stats.Nodes)
+	}
+	// counting doesn't change the search
+	updates := dl.ops.updates
+	dl.Search(context.Background(), nil)
+	if dl.N != 36 || dl.S != stats.Steps {
+		t.Errorf("expected search to find 36 solutions in %d steps, got %d in %d", stats.Steps, dl.N, dl.S)
+	}
+	if dl.ops.updates-updates != stats.TotalUpdates() {
+		t.Errorf("expected %d updates, got %d", dl.ops.updates-updates, stats.TotalUpdates())
+	}
+	for k, u := range stats.Updates {
+		if u < 0 || (k < 8 && u == 0) {
+			t.Errorf("bad number of updates %d at level %d", u, k)
+		}
+	}
+	// the steps are the nodes, choices, covers and uncovers
+	steps := stats.TotalNodes() + sum(stats.Choices) + stats.Covers + stats.Uncovers
+	if steps != stats.Steps || stats.Covers != stats.Uncovers {
+		t.Errorf("expected %d steps to add up, got %d", stats.Steps, steps)
+	}
+	// every node but the solutions chooses a column, and the branches of
+	// each level are the nodes of the next
+	for k := range stats.Nodes {
+		leaves := 0
+		if k == 8 {
+			leaves = 36
+		}
+		if stats.Choices[k] != stats.Nodes[k]-leaves {
+			t.Errorf("expected %d choices at level %d, got %d", stats.Nodes[k]-leaves, k, stats.Choices[k])
+		}
+		if k+1 < len(stats.Nodes) && stats.Branches[k] != stats.Nodes[k+1] {
+			t.Errorf("expected %d branches at level %d, got %d", stats.Nodes[k+1], k, stats.Branches[k])
+		}
+	}
+}
+
+func TestChooser(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	choosers := map[string]ColumnChooser{
+		"mrv":    MRV{},
+		"last":   MRVLast{},
+		"random": NewMRVRandom(rand.New(rand.NewSource(1))),
+		"first":  PreferFirst(4, len(names)),
+		"rest":   PreferLast(4, len(names)),
+	}
+	steps := make(map[string]int)
+	for name, ch := range choosers {
+		dl := New(matrix, names)
+		dl.SetChooser(ch)
+		dl.Search(context.Background(), nil)
+		if dl.N != 36 {
+			t.Errorf("%s: expected 36 solutions, got %d", name, dl.N)
+		}
+		steps[name] = dl.S
+	}
+	dl := New(matrix, names)
+	dl.Search(context.Background(), nil)
+	if steps["mrv"] != dl.S {
+		t.Errorf("expected MRV to take the default %d steps, got %d", dl.S, steps["mrv"])
+	}
+
+	// the first column chosen is the first of the lowest priority
+	dl = New(matrix, names)
+	p := make(Priority, len(names))
+	for x := range p {
+		p[x] = 1
+	}
+	p[5] = 0
+	if c := p.Choose(dl); c.Index() != 5 {
+		t.Errorf("expected priority to choose column 5, got %d", c.Index())
+	}
+	if c := (MRVLast{}).Choose(dl); c.Index() != 15 {
+		t.Errorf("expected MRVLast to choose the last corner, got %d", c.Index())
+	}
+
+	// a deterministic chooser replays the same in parallel
+	dl = New(matrix, names)
+	dl.SetChooser(MRVLast{})
+	dl.Search(context.Background(), nil)
+	serial := dl.S
+	dl.SearchParallel(context.Background(), 2, 3, nil)
+	if dl.N != 36 || dl.S != serial {
+		t.Errorf("expected 36 solutions in %d steps in parallel, got %d in %d", serial, dl.N, dl.S)
+	}
+}
+
+func TestFlat(t *testing.T) {
+	for _, size := range [][2]int{{4, 4}, {3, 6}, {1, 5}} {
+		matrix, names := dominoMatrix(size[0], size[1])
+		linked := New(matrix, names)
+		var expect []Solution
+		linked.Search(context.Background(), collect(&expect, 0))
+		dl := NewFlat(matrix, names, nil)
+		var solutions []Solution
+		dl.Search(context.Background(), collect(&solutions, 0))
+		if dl.N != linked.N || dl.S != linked.S {
+			t.Errorf("%dx%d: got N=%d S=%d, expected N=%d S=%d", size[0], size[1], dl.N, dl.S, linked.N, linked.S)
+		}
+		if !reflect.DeepEqual(solutions, expect) {
+			t.Errorf("%dx%d: solutions differ from the linked search", size[0], size[1])
+		}
+	}
+
+	// secondary columns and empty rows
+	matrix := [][]bool{
+		{true, false, true},
+		{false, false, false},
+		{false, true, true},
+		{true, false, false},
+		{false, true, false},
+	}
+	names := []string{"A", "B", "x"}
+	secondary := []bool{false, false, true}
+	linked := NewSecondary(matrix, names, secondary)
+	var expect []Solution
+	linked.Search(context.Background(), collect(&expect, 0))
+	dl := NewFlat(matrix, names, secondary)
+	var solutions []Solution
+	dl.Search(context.Background(), collect(&solutions, 0))
+	if dl.N != 3 || dl.S != linked.S || !reflect.DeepEqual(solutions, expect) {
+		t.Errorf("expected %v in %d steps, got %v in %d", expect, linked.S, solutions, dl.S)
+	}
+
+	// stopping and cancelling leave the links so a second search finds everything
+	matrix, names = dominoMatrix(4, 4)
+	dl = NewFlat(matrix, names, nil)
+	solutions = nil
+	dl.Search(context.Background(), collect(&solutions, 5))
+	ctx, cancel := context.WithCancel(context.Background())
+	err := dl.Search(ctx, func(Solution) bool {
+		cancel()
+		return true
+	})
+	if err != context.Canceled || dl.N >= 36 {
+		t.Errorf("expected the search to be cancelled, got %v with %d solutions", err, dl.N)
+	}
+	dl.Search(context.Background(), nil)
+	if dl.N != 36 {
+		t.Errorf("expected 36 solutions after stopping, got %d", dl.N)
+	}
+}
+
+func TestSparse(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	dense := New(matrix, names)
+	var expect []Solution
+	dense.Search(context.Background(), collect(&expect, 0))
+	var options [][]int
+	for _, row := range matrix {
+		var option []int
+		for x, b := range row {
+			if b {
+				option = append(option, x)
+			}
+		}
+		options = append(options, option)
+	}
+	links, flat := NewSparse(options, names, nil, nil), NewFlatSparse(options, names, nil)
+	for name, search := range map[string]func(context.Context, func(Solution) bool) error{
+		"links": links.Search,
+		"flat":  flat.Search,
+	} {
+		var solutions []Solution
+		search(context.Background(), collect(&solutions, 0))
+		if !reflect.DeepEqual(solutions, expect) {
+			t.Errorf("%s: expected the dense search's 36 solutions", name)
+		}
+	}
+	if links.N != 36 || links.S != dense.S || flat.N != 36 || flat.S != dense.S {
+		t.Errorf("expected 36 solutions in %d steps, got %d in %d and %d in %d", dense.S, links.N, links.S, flat.N, flat.S)
+	}
+
+	// the colors go with the columns of each option
+	colors := [][]string{{"", "A"}, {"", "B"}, {"A", ""}}
+	dl := NewSparse([][]int{{0, 2}, {1, 2}, {2, 1}}, []string{"p", "q", "x"}, []bool{false, false, true}, colors)
+	var solutions []Solution
+	dl.Search(context.Background(), collect(&solutions, 0))
+	if dl.N != 1 || !reflect.DeepEqual(solutions[0], Solution{0, 2}) {
+		t.Errorf("expected the rows with color A, got %v", solutions)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic for a repeated column")
+		}
+	}()
+	NewSparse([][]int{{0, 0}}, []string{"p"}, nil, nil)
+}
+
+func TestProblem(t *testing.T) {
+	// Knuth's example from TAOCP 7.2.2.1 with colors
+	text := `| a comment
+p q r | x y
+p q x y:A
+p r x:A y
+| another comment
+p x:B
+q x:A
+r y:B
+`
+	p, err := ReadProblem(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Columns) != 5 || len(p.Options) != 5 || !p.Secondary[3] || p.Lo != nil {
+		t.Fatalf("misread problem %+v", p)
+	}
+	dl := p.DancingLinks()
+	var solutions []Solution
+	dl.Search(context.Background(), collect(&solutions, 0))
+	if dl.N != 1 {
+		t.Fatalf("expected 1 solution, got %d", dl.N)
+	}
+	sort.Ints(solutions[0])
+	if p.OptionString(solutions[0][0]) != "p r x:A y" || p.OptionString(solutions[0][1]) != "q x:A" {
+		t.Errorf("expected options 1 and 3, got %v", solutions[0])
+	}
+
+	// writing and reading back gives the same problem
+	var b bytes.Buffer
+	p.Write(&b)
+	q, err := ReadProblem(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, q) {
+		t.Errorf("expected %+v after writing and reading, got %+v", p, q)
+	}
+
+	// bounds
+	p, err = ReadProblem(strings.NewReader("2:3|A | B1 B2 B3 B4\nA B1\nA B2\nA B3\nA B4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	p.Write(&b)
+	if !strings.HasPrefix(b.String(), "2:3|A | B1") {
+		t.Errorf("expected bounds to be written, got %s", b.String())
+	}
+	dl = p.DancingLinks()
+	dl.Search(context.Background(), nil)
+	if dl.N != 10 {
+		t.Errorf("expected 10 solutions with bounds, got %d", dl.N)
+	}
+
+	for _, bad := range []string{
+		"",
+		"a a\n",
+		"a | b | c\n",
+		"a\nb\n",
+		"a | x\na:A\n",
+		"a | x\na x x\n",
+		"a | 2|x\n",
+		"3:2|a\n",
+	} {
+		if _, err := ReadProblem(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error reading %q", bad)
+		}
+	}
+}
+
+// the distinct sets of options chosen by the models of a small CNF,
+// found by trying every assignment
+func bruteSAT(t *testing.T, text string, options int) map[string]bool {
+	var (
+		vars    int
+		clauses [][]int
+		clause  []int
+	)
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "c" {
+			continue
+		}
+		if fields[0] == "p" {
+			fmt.Sscan(fields[2], &vars)
+			continue
+		}
+		for _, f := range fields {
+			var lit int
+			fmt.Sscan(f, &lit)
+			if lit == 0 {
+				clauses = append(clauses, clause)
+				clause = nil
+			} else {
+				clause = append(clause, lit)
+			}
+		}
+	}
+	if vars > 24 {
+		t.Fatalf("too many variables to try them all: %d", vars)
+	}
+	models := make(map[string]bool)
+	for a := 0; a < 1<<vars; a++ {
+		sat := true
+		for _, clause := range clauses {
+			ok := false
+			for _, lit := range clause {
+				v := lit
+				if v < 0 {
+					v = -v
+				}
+				if (a>>(v-1))&1 == 1 == (lit > 0) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				sat = false
+				break
+			}
+		}
+		if sat {
+			var model bytes.Buffer
+			for v := 1; v <= vars; v++ {
+				if (a>>(v-1))&1 == 1 {
+					fmt.Fprintf(&model, "%d ", v)
+				}
+			}
+			soln, _ := ReadModel(strings.NewReader("v "+model.String()+"0"), options)
+			models[fmt.Sprint(soln)] = true
+		}
+	}
+	return models
+}
+
+func TestCNF(t *testing.T) {
+	knuth := "A B C D E F G\nC E F\nA D G\nB C F\nA D\nB G\nD E G\n"
+	colors := "p q r | x y\np q x y:A\np r x:A y\np x:B\nq x:A\nr y:B\n"
+	bounds := "2:3|A | B1 B2 B3 B4\nA B1\nA B2\nA B3\nA B4\n"
+	for _, text := range []string{knuth, colors, bounds} {
+		p, err := ReadProblem(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := make(map[string]bool)
+		p.DancingLinks().Search(context.Background(), func(soln Solution) bool {
+			soln = append(Solution{}, soln...)
+			sort.Ints(soln)
+			if err := p.Verify(soln); err != nil {
+				t.Errorf("solution %v doesn't verify: %s", soln, err)
+			}
+			expect[fmt.Sprint(soln)] = true
+			return true
+		})
+		for _, enc := range []Encoding{Pairwise, Sequential} {
+			var b bytes.Buffer
+			if err := p.WriteCNF(&b, enc); err != nil {
+				t.Fatal(err)
+			}
+			models := bruteSAT(t, b.String(), len(p.Options))
+			if !reflect.DeepEqual(models, expect) {
+				t.Errorf("encoding %d of %q: expected models %v, got %v", enc, text, expect, models)
+			}
+		}
+	}
+
+	soln, err := ReadModel(strings.NewReader("c comment\ns SATISFIABLE\nv -1 2 -3\nv 4 7 0\n"), 5)
+	if err != nil || !reflect.DeepEqual(soln, Solution{1, 3}) {
+		t.Errorf("expected options [1 3], got %v %v", soln, err)
+	}
+	if _, err := ReadModel(strings.NewReader("UNSAT\n"), 5); err != ErrUnsatisfiable {
+		t.Errorf("expected ErrUnsatisfiable, got %v", err)
+	}
+}
+
+func TestZDD(t *testing.T) {
+	matrix, names := dominoMatrix(4, 4)
+	dominoes := &Problem{Columns: names, Options: sparse(matrix, len(names))}
+	knuth := "A B C D E F G\nC E F\nA D G\nB C F\nA D\nB G\nD E G\n"
+	colors := "p q r | x y\np q x y:A\np r x:A y\np x:B\nq x:A\nr y:B\n"
+	bounds := "2:3|A | B1 B2 B3 B4\nA B1\nA B2\nA B3\nA B4\n"
+	// two piece columns with counts sharing the cells
+	pieces := "0:2|P 1:2|Q c1 c2 c3 c4\nP c1 c2\nP c3 c4\nP c2 c3\nQ c1\nQ c4\nQ c2 c3\nc1\nc4\n"
+	problems := []*Problem{dominoes}
+	for _, text := range []string{knuth, colors, bounds, pieces} {
+		p, err := ReadProblem(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		problems = append(problems, p)
+	}
+	for _, p := range problems {
+		var expect []string
+		p.DancingLinks().Search(context.Background(), func(soln Solution) bool {
+			soln = append(Solution{}, soln...)
+			sort.Ints(soln)
+			expect = append(expect, fmt.Sprint(soln))
+			return true
+		})
+		sort.Strings(expect)
+		z, err := p.ZDD(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z.Count().Int64() != int64(len(expect)) {
+			t.Errorf("expected %d solutions of %v, got %s", len(expect), p.Columns, z.Count())
+		}
+		var got []string
+		z.Solutions(func(soln Solution) bool {
+			got = append(got, fmt.Sprint(soln))
+			return true
+		})
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("expected solutions %v, got %v", expect, got)
+		}
+	}
+
+	// the 36 domino tilings are sampled evenly
+	z, _ := dominoes.ZDD(context.Background())
+	rng := rand.New(rand.NewSource(1))
+	counts := make(map[string]int)
+	for i := 0; i < 36000; i++ {
+		soln := z.Sample(rng)
+		if err := dominoes.Verify(soln); err != nil {
+			t.Fatalf("sample %v doesn't verify: %s", soln, err)
+		}
+		counts[fmt.Sprint(soln)]++
+	}
+	if len(counts) != 36 {
+		t.Errorf("expected all 36 tilings to be sampled, got %d", len(counts))
+	}
+	for soln, n := range counts {
+		if n < 800 || n > 1200 {
+			t.Errorf("expected tiling %s about 1000 times, got %d", soln, n)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	matrix, names = dominoMatrix(8, 8)
+	big := &Problem{Columns: names, Options: sparse(matrix, len(names))}
+	if _, err := big.ZDD(ctx); err != context.Canceled {
+		t.Errorf("expected a cancelled build, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package dlx
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Estimate of the size of a search, from Knuth's random path estimator.
+// Each probe walks from the root to a leaf choosing a random branch at each
+// node.  Weighting each node on the path by the product of the branching
+// degrees above it gives an unbiased estimate of the number of nodes in the
+// tree, and the same for solutions and steps.  The estimates are averaged
+// over the probes.
+type Estimate struct {
+	Probes    int
+	Nodes     float64 // expected number of nodes in the search tree
+	Solutions float64 // expected number of solutions
+	Steps     float64 // expected S of a full search
+	Rate      float64 // steps per second of a short run of the real search
+}
+
+// how long the real search is run to measure its rate
+const rateSample = time.Second
+
+// rough number of seconds a full serial search would take
+func (e *Estimate) Seconds() float64 {
+	if e.Rate == 0 {
+		return 0
+	}
+	return e.Steps / e.Rate
+}
+
+// Estimate the size of the search with the given number of random probes.
+// probing is much slower per step than searching, so the rate is measured
+// by running the real search for a moment
+func (dl *DancingLinks) Estimate(probes int, rng *rand.Rand) *Estimate {
+	e := &Estimate{Probes: probes}
+	for i := 0; i < probes; i++ {
+		dl.probe(1, e, rng)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rateSample)
+	defer cancel()
+	start := time.Now()
+	dl.Search(ctx, nil)
+	if elapsed := time.Now().Sub(start).Seconds(); elapsed > 0 {
+		e.Rate = float64(dl.S) / elapsed
+	}
+	dl.N, dl.S = 0, 0
+	if probes > 0 {
+		e.Nodes /= float64(probes)
+		e.Solutions /= float64(probes)
+		e.Steps /= float64(probes)
+	}
+	return e
+}
+
+// probe follows a random path down the search tree from the current node,
+// which has weight w.  the steps a full search would take at each node are
+// estimated as the steps of the sampled branch times the number of branches
+func (dl *DancingLinks) probe(w float64, e *Estimate, rng *rand.Rand) {
+	before := dl.S
+	dl.S++
+	e.Nodes += w
+	if dl.root.R == &dl.root.Node {
+		e.Solutions += w
+		e.Steps += w
+		return
+	}
+	c := dl.chooseColumn()
+	if c.bounded() {
+		dl.probeBounded(c, w, dl.S-before, e, rng)
+		return
+	}
+	dl.cover(c)
+	setup := dl.S - before
+	d := c.S
+	branch := 0
+	if d > 0 {
+		r := c.D
+		for i := rng.Intn(d); i > 0; i-- {
+			r = r.D
+		}
+		s := dl.S
+		dl.commitRow(r)
+		branch = dl.S - s
+		dl.probe(w*float64(d), e, rng)
+		s = dl.S
+		dl.uncommitRow(r)
+		branch += dl.S - s
+	}
+	s := dl.S
+	dl.uncover(c)
+	e.Steps += w * float64(setup+dl.S-s+d*branch)
+}
+
+// like probe, for a node branching on a bounded column.  as in searchBounded,
+// the rows above the sampled one are removed, and the last branch chooses
+// no more rows for c
+func (dl *DancingLinks) probeBounded(c *Column, w float64, setup int, e *Estimate, rng *rand.Rand) {
+	var rows []*Node
+	d := 0
+	if c.branches() > 0 {
+		for r := c.D; r != &c.Node; r = r.D {
+			rows = append(rows, r)
+		}
+		d = len(rows)
+		if c.used >= c.lo {
+			d++
+		}
+	}
+	branch := 0
+	if d > 0 {
+		i := rng.Intn(d)
+		n := i + 1
+		if n > len(rows) {
+			n = len(rows)
+		}
+		for _, r := range rows[:n] {
+			dl.remove(r)
+		}
+		s := dl.S
+		if i < len(rows) {
+			dl.use(c)
+			dl.commitRow(rows[i])
+		} else {
+			dl.cover(c)
+		}
+		branch = dl.S - s
+		dl.probe(w*float64(d), e, rng)
+		s = dl.S
+		if i < len(rows) {
+			dl.uncommitRow(rows[i])
+			dl.unuse(c)
+		} else {
+			dl.uncover(c)
+		}
+		branch += dl.S - s
+		for j := n - 1; j >= 0; j-- {
+			dl.restore(rows[j])
+		}
+	}
+	e.Steps += w * float64(setup+d*branch)
+}
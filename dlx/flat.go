@@ -0,0 +1,252 @@
+package dlx
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Flat is the dancing links kept in flat arrays of int32 indices instead of
+// linked structs, like Knuth's dlx1.  The nodes sit next to each other in
+// memory row by row, so the search walks along cache lines instead of chasing
+// pointers, and building the links takes a few big allocations.
+//
+// Node 0 is the root and nodes 1..w are the column headers, whose T is the
+// column size.  After them, the nodes of each row are laid out left to right
+// between spacer nodes.  A spacer's T is -1-y for row y of the row after it,
+// its U is the first node of the row before it and its D is the last node of
+// the row after it, so a row can be walked around by jumping at the spacers.
+//
+// It searches exactly like the linked DancingLinks, with the same S, but
+// only has primary and secondary columns, uses MRV to choose columns, and
+// only does a plain serial Search
+type Flat struct {
+	N, S  int // number of solutions found and steps taken
+	nodes []flatNode
+	cols  []flatCol // L/R links of the root and columns
+	o     []int32
+
+	// state of the running search
+	visit     func(Solution) bool
+	done      <-chan struct{}
+	stop      bool
+	cancelled bool
+}
+
+type flatNode struct {
+	U, D int32
+	T    int32 // the column of the node, the size of a column or -1-y for a spacer
+}
+
+type flatCol struct {
+	L, R int32
+}
+
+// NewFlat builds dancing links for the matrix like NewSecondary, but using
+// the flat array engine.  It's faster and uses less memory
+func NewFlat(matrix [][]bool, columnNames []string, secondary []bool) *Flat {
+	return NewFlatSparse(sparse(matrix, len(columnNames)), columnNames, secondary)
+}
+
+// like NewFlat, but with the rows given as options like NewSparse
+func NewFlatSparse(options [][]int, columnNames []string, secondary []bool) *Flat {
+	w := len(columnNames)
+	if secondary != nil && len(secondary) != w {
+		panic("number of secondary flags doesn't match number of matrix columns")
+	}
+	size := w + 2
+	for _, option := range options {
+		size += len(option) + 1
+	}
+	f := &Flat{
+		nodes: make([]flatNode, w+1, size),
+		cols:  make([]flatCol, w+1),
+	}
+	// the header list.  secondary columns link to themselves
+	last := int32(0)
+	for x := 1; x <= w; x++ {
+		i := int32(x)
+		f.nodes[i] = flatNode{U: i, D: i}
+		if secondary != nil && secondary[x-1] {
+			f.cols[i] = flatCol{L: i, R: i}
+			continue
+		}
+		f.cols[i].L = last
+		f.cols[last].R = i
+		last = i
+	}
+	f.cols[last].R = 0
+	f.cols[0].L = last
+
+	// the rows, each after a spacer
+	spacer := int32(w + 1)
+	f.nodes = append(f.nodes, flatNode{})
+	seen := make([]int, w) // the last row + 1 to cover each column
+	for y, option := range options {
+		first := int32(len(f.nodes))
+		for _, x := range option {
+			if x < 0 || x >= w {
+				panic(fmt.Sprintf("bad option %d: column %d out of range", y, x))
+			}
+			if seen[x] == y+1 {
+				panic(fmt.Sprintf("bad option %d: column %s repeated", y, columnNames[x]))
+			}
+			seen[x] = y + 1
+			c := int32(x + 1)
+			i := int32(len(f.nodes))
+			up := f.nodes[c].U
+			f.nodes = append(f.nodes, flatNode{U: up, D: c, T: c})
+			f.nodes[up].D = i
+			f.nodes[c].U = i
+			f.nodes[c].T++
+		}
+		n := int32(len(f.nodes))
+		if n == first {
+			continue // empty row
+		}
+		f.nodes[spacer].T = int32(-1 - y)
+		f.nodes[spacer].D = n - 1
+		f.nodes = append(f.nodes, flatNode{U: first, T: math.MinInt32})
+		spacer = n
+	}
+	f.nodes[spacer].T = math.MinInt32
+	return f
+}
+
+// Search finds all exact covers like DancingLinks.Search
+func (f *Flat) Search(ctx context.Context, fn func(Solution) bool) error {
+	f.N, f.S = 0, 0
+	f.o = f.o[:0]
+	f.visit = fn
+	f.done = ctx.Done()
+	f.stop, f.cancelled = false, false
+	f.search(0)
+	if f.cancelled {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// search(k) on the flat links
+func (f *Flat) search(k int) {
+	f.S++
+	nodes, cols := f.nodes, f.cols
+	if cols[0].R == 0 {
+		f.recordSolution(k)
+		return
+	}
+	select {
+	case <-f.done:
+		f.stop, f.cancelled = true, true
+		return
+	default:
+	}
+	if len(f.o) <= k {
+		f.o = append(f.o, 0)
+	}
+
+	// choose the column with the fewest rows
+	f.S++
+	c := int32(0)
+	s := int32(math.MaxInt32)
+	for i := cols[0].R; i != 0; i = cols[i].R {
+		if nodes[i].T < s {
+			c = i
+			s = nodes[i].T
+		}
+	}
+
+	f.cover(c)
+	for r := nodes[c].D; r != c && !f.stop; r = nodes[r].D {
+		f.o[k] = r
+		// cover the other columns of the row, left to right around it
+		for p := r + 1; p != r; {
+			j := nodes[p].T
+			if j <= 0 {
+				p = nodes[p].U
+			} else {
+				f.cover(j)
+				p++
+			}
+		}
+		f.search(k + 1)
+		for p := r - 1; p != r; {
+			j := nodes[p].T
+			if j <= 0 {
+				p = nodes[p].D
+			} else {
+				f.uncover(j)
+				p--
+			}
+		}
+	}
+	f.uncover(c)
+}
+
+func (f *Flat) cover(c int32) {
+	f.S++
+	nodes := f.nodes
+	l, r := f.cols[c].L, f.cols[c].R
+	f.cols[l].R = r
+	f.cols[r].L = l
+	for i := nodes[c].D; i != c; i = nodes[i].D {
+		// hide the row of i
+		for q := i + 1; q != i; {
+			x := nodes[q].T
+			if x <= 0 {
+				q = nodes[q].U
+				continue
+			}
+			u, d := nodes[q].U, nodes[q].D
+			nodes[u].D = d
+			nodes[d].U = u
+			nodes[x].T--
+			q++
+		}
+	}
+}
+
+func (f *Flat) uncover(c int32) {
+	f.S++
+	nodes := f.nodes
+	for i := nodes[c].U; i != c; i = nodes[i].U {
+		// unhide the row of i
+		for q := i - 1; q != i; {
+			x := nodes[q].T
+			if x <= 0 {
+				q = nodes[q].D
+				continue
+			}
+			u, d := nodes[q].U, nodes[q].D
+			nodes[u].D = q
+			nodes[d].U = q
+			nodes[x].T++
+			q--
+		}
+	}
+	l, r := f.cols[c].L, f.cols[c].R
+	f.cols[l].R = c
+	f.cols[r].L = c
+}
+
+// the matrix row of node i, from the spacer before it
+func (f *Flat) row(i int32) int {
+	for f.nodes[i].T > 0 {
+		i--
+	}
+	return int(-1 - f.nodes[i].T)
+}
+
+func (f *Flat) recordSolution(k int) {
+	f.N++
+	if f.visit == nil {
+		return
+	}
+	soln := make(Solution, k)
+	for i, o := range f.o[:k] {
+		soln[i] = f.row(o)
+	}
+	if !f.visit(soln) {
+		f.stop = true
+	}
+}
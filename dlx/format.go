@@ -0,0 +1,247 @@
+package dlx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Problem is an exact cover problem as written for Knuth's dlx programs.
+// The first line names the columns, or items, with a | between the primary
+// and the secondary ones.  A primary column can have bounds like 2:3|x, or 2|x
+// for exactly 2, as in dlx3.  Each line after that is an option, naming the
+// columns a row covers.  A secondary column in an option can have a color like
+// x:A, as in dlx2.  Lines starting with | are comments.
+type Problem struct {
+	Columns   []string
+	Secondary []bool     // nil when they're all primary
+	Lo, Hi    []int      // bounds on the columns, nil when they're all covered once
+	Options   [][]int    // the columns of each row
+	Colors    [][]string // indexed like Options, nil when there are no colors
+}
+
+// DancingLinks builds the links for searching the problem.  It panics with a
+// *MatrixError for a bad problem, like NewSparse
+func (p *Problem) DancingLinks() *DancingLinks {
+	dl, err := p.Build()
+	if err != nil {
+		panic(err)
+	}
+	return dl
+}
+
+// Build is DancingLinks, but returns a *MatrixError for a bad problem
+// instead of panicking
+func (p *Problem) Build() (*DancingLinks, error) {
+	dl, err := Build(p.Options, p.Columns, p.Secondary, p.Colors)
+	if err != nil {
+		return nil, err
+	}
+	for x := range p.Lo {
+		if p.Lo[x] != 1 || p.Hi[x] != 1 {
+			if err := dl.SetBounds(x, p.Lo[x], p.Hi[x]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dl, nil
+}
+
+// ReadProblem reads a problem in the format of Knuth's dlx programs
+func ReadProblem(r io.Reader) (*Problem, error) {
+	p := &Problem{}
+	index := make(map[string]int)
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<24)
+	line := 0
+	for s.Scan() {
+		line++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(s.Text(), "|") {
+			continue
+		}
+		var err error
+		if p.Columns == nil {
+			err = p.readColumns(fields, index)
+		} else {
+			err = p.readOption(fields, index)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if p.Columns == nil {
+		return nil, errors.New("no columns")
+	}
+	return p, nil
+}
+
+func (p *Problem) readColumns(fields []string, index map[string]int) error {
+	secondary := false
+	for _, f := range fields {
+		if f == "|" {
+			if secondary {
+				return errors.New("more than one | between primary and secondary columns")
+			}
+			secondary = true
+			continue
+		}
+		lo, hi := 1, 1
+		if i := strings.LastIndex(f, "|"); i >= 0 {
+			if secondary {
+				return fmt.Errorf("secondary column %s can't have bounds", f)
+			}
+			var err error
+			if lo, hi, err = parseBounds(f[:i]); err != nil {
+				return fmt.Errorf("bad bounds for column %s: %s", f, err)
+			}
+			f = f[i+1:]
+		}
+		if f == "" || strings.ContainsAny(f, ":|") {
+			return fmt.Errorf("bad column name %q", f)
+		}
+		if _, ok := index[f]; ok {
+			return fmt.Errorf("column %s named twice", f)
+		}
+		index[f] = len(p.Columns)
+		p.Columns = append(p.Columns, f)
+		p.Secondary = append(p.Secondary, secondary)
+		p.Lo = append(p.Lo, lo)
+		p.Hi = append(p.Hi, hi)
+	}
+	if len(p.Columns) == 0 {
+		return errors.New("no columns")
+	}
+	// keep the optional parts nil when they're not used
+	if !secondary {
+		p.Secondary = nil
+	}
+	bounded := false
+	for x := range p.Lo {
+		bounded = bounded || p.Lo[x] != 1 || p.Hi[x] != 1
+	}
+	if !bounded {
+		p.Lo, p.Hi = nil, nil
+	}
+	return nil
+}
+
+// parses lo:hi or n, for n:n
+func parseBounds(s string) (int, int, error) {
+	i := strings.Index(s, ":")
+	if i < 0 {
+		n, err := strconv.Atoi(s)
+		return n, n, err
+	}
+	lo, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return 0, 0, err
+	}
+	if lo < 0 || hi < 1 || lo > hi {
+		return 0, 0, fmt.Errorf("%d:%d is out of order", lo, hi)
+	}
+	return lo, hi, nil
+}
+
+func (p *Problem) readOption(fields []string, index map[string]int) error {
+	option := make([]int, 0, len(fields))
+	colors := make([]string, 0, len(fields))
+	colored := false
+	for _, f := range fields {
+		name, color := f, ""
+		if i := strings.Index(f, ":"); i >= 0 {
+			name, color = f[:i], f[i+1:]
+			if color == "" {
+				return fmt.Errorf("missing color in %s", f)
+			}
+		}
+		x, ok := index[name]
+		if !ok {
+			return fmt.Errorf("unknown column %s", name)
+		}
+		for _, y := range option {
+			if y == x {
+				return fmt.Errorf("column %s repeated", name)
+			}
+		}
+		if color != "" {
+			if !p.isSecondary(x) {
+				return fmt.Errorf("primary column %s can't have a color", name)
+			}
+			colored = true
+		}
+		option = append(option, x)
+		colors = append(colors, color)
+	}
+	if colored && p.Colors == nil {
+		p.Colors = make([][]string, len(p.Options))
+		for y := range p.Colors {
+			p.Colors[y] = make([]string, len(p.Options[y]))
+		}
+	}
+	p.Options = append(p.Options, option)
+	if p.Colors != nil {
+		p.Colors = append(p.Colors, colors)
+	}
+	return nil
+}
+
+func (p *Problem) isSecondary(x int) bool {
+	return p.Secondary != nil && p.Secondary[x]
+}
+
+// Write the problem in the format of Knuth's dlx programs
+func (p *Problem) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var primary, secondary []string
+	for x, name := range p.Columns {
+		if p.isSecondary(x) {
+			secondary = append(secondary, name)
+			continue
+		}
+		if p.Lo != nil && p.Lo[x] == p.Hi[x] && p.Lo[x] != 1 {
+			name = fmt.Sprintf("%d|%s", p.Lo[x], name)
+		} else if p.Lo != nil && p.Lo[x] != p.Hi[x] {
+			name = fmt.Sprintf("%d:%d|%s", p.Lo[x], p.Hi[x], name)
+		}
+		primary = append(primary, name)
+	}
+	bw.WriteString(strings.Join(primary, " "))
+	if len(secondary) > 0 {
+		bw.WriteString(" | ")
+		bw.WriteString(strings.Join(secondary, " "))
+	}
+	bw.WriteRune('\n')
+	for y := range p.Options {
+		bw.WriteString(p.OptionString(y))
+		bw.WriteRune('\n')
+	}
+	return bw.Flush()
+}
+
+// OptionString is option y as a line of the problem's format
+func (p *Problem) OptionString(y int) string {
+	var b bytes.Buffer
+	for i, x := range p.Options[y] {
+		if i > 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteString(p.Columns[x])
+		if p.Colors != nil && p.Colors[y][i] != "" {
+			b.WriteRune(':')
+			b.WriteString(p.Colors[y][i])
+		}
+	}
+	return b.String()
+}
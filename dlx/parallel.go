@@ -0,0 +1,142 @@
+package dlx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SearchParallel finds the same solutions as Search using the given number of
+// goroutines.  The search tree is split into the subtrees found at the given
+// depth and each worker searches a subtree on its own copy of the links.
+// Solutions are passed to fn in the order Search would find them, a subtree
+// at a time, so the solutions, N and S match the serial run.  Each worker
+// streams its subtree's solutions to the merge, and waits once it's a few
+// ahead, so pass a nil fn if only N is needed to let the workers run freely
+func (dl *DancingLinks) SearchParallel(ctx context.Context, workers, depth int, fn func(Solution) bool) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	dl.N, dl.S = 0, 0
+	dl.o = dl.o[:0]
+	// the steps taken above the split are counted here, those below are
+	// counted by the worker that searches the subtree
+	split := &walk{split: true, depth: depth}
+	dl.start(ctx, nil)
+	dl.walk = split
+	dl.search(0)
+	dl.walk = nil
+	if dl.cancelled {
+		return ctx.Err()
+	}
+	branches := split.branches
+	if dl.debug {
+		fmt.Printf("split search into %d branches at depth %d\n", len(branches), depth)
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*branchResult, len(branches))
+	jobs := make(chan int, len(branches))
+	for b := range branches {
+		results[b] = &branchResult{solutions: make(chan Solution, branchBuffer)}
+		jobs <- b
+	}
+	close(jobs)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := dl.copy()
+			for b := range jobs {
+				w.searchBranch(wctx, branches[b], fn != nil, results[b])
+				close(results[b].solutions)
+			}
+		}()
+	}
+
+	// merge the results in order
+	stopped, cancelled := false, false
+	for _, res := range results {
+		for soln := range res.solutions {
+			dl.N++
+			if !fn(soln) {
+				stopped = true
+				break
+			}
+		}
+		if stopped {
+			break
+		}
+		// the branch is done once its solutions are closed
+		if res.cancelled {
+			cancelled = true
+			break
+		}
+		dl.S += res.s
+		if fn == nil {
+			dl.N += res.n
+		}
+	}
+	cancel()
+	wg.Wait()
+	if cancelled {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// the number of solutions a worker can find in its subtree before the merge
+// gets to them, after which it waits
+const branchBuffer = 64
+
+// the solutions of a subtree as they're found, closed once the search of the
+// subtree is done and the rest is set
+type branchResult struct {
+	solutions chan Solution
+	n, s      int
+	cancelled bool
+}
+
+// builds a fresh copy of the links with the same column settings
+func (dl *DancingLinks) copy() *DancingLinks {
+	w := newSparse(dl.options, dl.columnNames, dl.secondary, dl.colors, false)
+	for x, c := range dl.cols {
+		w.cols[x].lo, w.cols[x].hi = c.lo, c.hi
+	}
+	w.chooser = dl.chooser
+	w.debug = dl.debug
+	return w
+}
+
+// searchBranch replays the row choices of a branch found by the split on this
+// copy of the links and searches the subtree below it.
+// solutions are sent to the result if keep is set.  the branch counts as
+// cancelled if one can't be sent because the merge has stopped
+func (dl *DancingLinks) searchBranch(ctx context.Context, branch []int, keep bool, res *branchResult) {
+	var fn func(Solution) bool
+	lost := false
+	if keep {
+		fn = func(soln Solution) bool {
+			select {
+			case res.solutions <- soln:
+				return true
+			case <-ctx.Done():
+				lost = true
+				return false
+			}
+		}
+	}
+	w := &walk{path: append([]int(nil), branch...), only: true}
+	dl.N, dl.S = 0, 0
+	dl.o = dl.o[:0]
+	dl.start(ctx, fn)
+	dl.walk = w
+	dl.search(0)
+	dl.walk = nil
+	res.n, res.s, res.cancelled = dl.N, w.s, dl.cancelled || lost
+}
@@ -0,0 +1,190 @@
+package dlx
+
+import (
+	"context"
+	"math/rand"
+)
+
+// SetRandom makes the search try the rows of each column in a random order,
+// and breaks ties between columns at random unless a chooser is set, so each
+// search with a new seed finds the solutions in a different order.  Like
+// MRVRandom, it can't be used with SearchParallel or Resume.  nil goes back
+// to the rows in the order of the matrix
+func (dl *DancingLinks) SetRandom(rng *rand.Rand) {
+	dl.rng = rng
+}
+
+// RandomSolution searches with the rows in a random order and returns the
+// first solution found, or nil if there are none.  Solutions reached by
+// fewer choices are more likely than others, use Sample for an unbiased one
+func (dl *DancingLinks) RandomSolution(rng *rand.Rand) Solution {
+	dl.SetRandom(rng)
+	defer dl.SetRandom(nil)
+	var first Solution
+	dl.Search(context.Background(), func(soln Solution) bool {
+		first = soln
+		return false
+	})
+	return first
+}
+
+// branches on column c at level k, trying its rows in a random order
+func (dl *DancingLinks) searchShuffled(k int, c *Column) {
+	rows := make([]*Node, 0, c.S)
+	for r := c.D; r != &c.Node; r = r.D {
+		rows = append(rows, r)
+	}
+	dl.rng.Shuffle(len(rows), func(i, j int) {
+		rows[i], rows[j] = rows[j], rows[i]
+	})
+	if !c.bounded() {
+		dl.cover(c)
+		for _, r := range rows {
+			if dl.stop {
+				break
+			}
+			dl.o[k] = r
+			dl.commitRow(r)
+			dl.search(k + 1)
+			dl.uncommitRow(r)
+		}
+		dl.uncover(c)
+		return
+	}
+
+	if c.branches() <= 0 {
+		return
+	}
+	// as in searchBounded, the rows tried so far are removed.  the branch
+	// choosing no more rows for c goes in at a random place among the others
+	stop := -1
+	if c.used >= c.lo {
+		stop = dl.rng.Intn(len(rows) + 1)
+	}
+	removed := 0
+	for i := 0; i <= len(rows) && !dl.stop; i++ {
+		if i == stop {
+			dl.o[k] = nil
+			dl.cover(c)
+			dl.search(k + 1)
+			dl.uncover(c)
+		}
+		if i == len(rows) || dl.stop {
+			break
+		}
+		r := rows[i]
+		dl.remove(r)
+		removed++
+		dl.o[k] = r
+		dl.use(c)
+		dl.commitRow(r)
+		dl.search(k + 1)
+		dl.uncommitRow(r)
+		dl.unuse(c)
+	}
+	for i := removed - 1; i >= 0; i-- {
+		dl.restore(rows[i])
+	}
+}
+
+// Sample picks a solution at random from the given number of random paths
+// down the search tree, like the probes of Estimate.  A path reaches a
+// solution with probability 1/w, w being the product of the branching degrees
+// along it, so picking among the solutions reached in proportion to w makes
+// each solution equally likely as the number of probes grows.  It returns nil
+// if no probe reached a solution
+func (dl *DancingLinks) Sample(probes int, rng *rand.Rand) Solution {
+	dl.o = dl.o[:0]
+	var (
+		soln  Solution
+		total float64
+	)
+	for i := 0; i < probes; i++ {
+		path, w := dl.randomPath(0, 1, rng)
+		if path == nil {
+			continue
+		}
+		total += w
+		if rng.Float64()*total < w {
+			soln = path
+		}
+	}
+	return soln
+}
+
+// follows a random path down from the node at level k, which has weight w,
+// and returns the solution it reaches with its weight, or nil at a dead end
+func (dl *DancingLinks) randomPath(k int, w float64, rng *rand.Rand) (Solution, float64) {
+	if dl.root.R == &dl.root.Node {
+		soln := Solution{}
+		for _, o := range dl.o[:k] {
+			if o != nil {
+				soln = append(soln, o.y)
+			}
+		}
+		return soln, w
+	}
+	if len(dl.o) <= k {
+		dl.o = append(dl.o, nil)
+	}
+	c := dl.chooseColumn()
+	if c.bounded() {
+		return dl.randomPathBounded(k, c, w, rng)
+	}
+	d := c.S
+	if d == 0 {
+		return nil, 0
+	}
+	r := c.D
+	for i := rng.Intn(d); i > 0; i-- {
+		r = r.D
+	}
+	dl.cover(c)
+	dl.o[k] = r
+	dl.commitRow(r)
+	soln, w := dl.randomPath(k+1, w*float64(d), rng)
+	dl.uncommitRow(r)
+	dl.uncover(c)
+	return soln, w
+}
+
+// like randomPath, branching on bounded column c as probeBounded does
+func (dl *DancingLinks) randomPathBounded(k int, c *Column, w float64, rng *rand.Rand) (Solution, float64) {
+	if c.branches() <= 0 {
+		return nil, 0
+	}
+	var rows []*Node
+	for r := c.D; r != &c.Node; r = r.D {
+		rows = append(rows, r)
+	}
+	d := len(rows)
+	if c.used >= c.lo {
+		d++
+	}
+	i := rng.Intn(d)
+	n := i + 1
+	if n > len(rows) {
+		n = len(rows)
+	}
+	for _, r := range rows[:n] {
+		dl.remove(r)
+	}
+	var soln Solution
+	if i < len(rows) {
+		dl.o[k] = rows[i]
+		dl.use(c)
+		dl.commitRow(rows[i])
+		soln, w = dl.randomPath(k+1, w*float64(d), rng)
+		dl.uncommitRow(rows[i])
+		dl.unuse(c)
+	} else {
+		dl.o[k] = nil
+		dl.cover(c)
+		soln, w = dl.randomPath(k+1, w*float64(d), rng)
+		dl.uncover(c)
+	}
+	for j := n - 1; j >= 0; j-- {
+		dl.restore(rows[j])
+	}
+	return soln, w
+}
@@ -0,0 +1,152 @@
+package dlx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Stats of a search, with the steps counted in S broken down by kind and by
+// level in the search tree, like the profile Knuth's dlx programs print.
+// Level k is the node reached after choosing k rows
+type Stats struct {
+	Solutions int `json:"solutions"`
+	Steps     int `json:"steps"`
+
+	Nodes    []int `json:"nodes"`     // nodes of the search tree at each level
+	Updates  []int `json:"updates"`   // nodes unlinked from column lists at each level
+	Choices  []int `json:"choices"`   // nodes at each level that chose a column to branch on
+	Branches []int `json:"branches"`  // sum of the branching degrees of the chosen columns
+	DeadEnds []int `json:"dead_ends"` // chosen columns with no branches
+
+	Covers     int `json:"covers"`
+	Uncovers   int `json:"uncovers"`
+	Purifies   int `json:"purifies"`
+	Unpurifies int `json:"unpurifies"`
+
+	subtree []int // updates in the subtrees under each level
+}
+
+// counters of the operations that make up the steps
+type ops struct {
+	updates              int // nodes unlinked from column lists, as counted by Knuth
+	covers, uncovers     int
+	purifies, unpurifies int
+}
+
+// Count runs the search without building solutions and gathers its stats.
+// Like Search it returns the context's error if cancelled, with the stats up
+// to that point
+func (dl *DancingLinks) Count(ctx context.Context) (*Stats, error) {
+	stats := &Stats{}
+	before := dl.ops
+	dl.stats = stats
+	err := dl.Search(ctx, nil)
+	dl.stats = nil
+	stats.Solutions, stats.Steps = dl.N, dl.S
+	stats.Covers = dl.ops.covers - before.covers
+	stats.Uncovers = dl.ops.uncovers - before.uncovers
+	stats.Purifies = dl.ops.purifies - before.purifies
+	stats.Unpurifies = dl.ops.unpurifies - before.unpurifies
+	stats.Updates = make([]int, len(stats.subtree))
+	for k := range stats.subtree {
+		stats.Updates[k] = stats.subtree[k]
+		if k+1 < len(stats.subtree) {
+			stats.Updates[k] -= stats.subtree[k+1]
+		}
+	}
+	stats.subtree = nil
+	return stats, err
+}
+
+// searches the node at level k, counting it and the updates made under it.
+// the updates of a node are the ones made under it less the ones its children
+// made, which are worked out once the search is done
+func (dl *DancingLinks) countNode(k int) {
+	s := dl.stats
+	if len(s.Nodes) <= k {
+		s.Nodes = append(s.Nodes, 0)
+		s.Choices = append(s.Choices, 0)
+		s.Branches = append(s.Branches, 0)
+		s.DeadEnds = append(s.DeadEnds, 0)
+		s.subtree = append(s.subtree, 0)
+	}
+	s.Nodes[k]++
+	updates := dl.ops.updates
+	dl.searchNode(k)
+	s.subtree[k] += dl.ops.updates - updates
+}
+
+// counts the choice of column c at level k
+func (s *Stats) choose(k int, c *Column) {
+	d := c.degree()
+	s.Choices[k]++
+	s.Branches[k] += d
+	if d == 0 {
+		s.DeadEnds[k]++
+	}
+}
+
+// the average branching degree of the columns chosen at level k
+func (s *Stats) Branching(k int) float64 {
+	if s.Choices[k] == 0 {
+		return 0
+	}
+	return float64(s.Branches[k]) / float64(s.Choices[k])
+}
+
+// total number of nodes in the search tree
+func (s *Stats) TotalNodes() int {
+	return sum(s.Nodes)
+}
+
+// total number of updates
+func (s *Stats) TotalUpdates() int {
+	return sum(s.Updates)
+}
+
+func sum(ns []int) int {
+	n := 0
+	for _, i := range ns {
+		n += i
+	}
+	return n
+}
+
+// Write the stats as lines of space separated fields: the totals, then a
+// line for each level
+func (s *Stats) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "solutions %d\nsteps %d\nnodes %d\nupdates %d\n"+
+		"choices %d\ncovers %d\nuncovers %d\npurifies %d\nunpurifies %d\n",
+		s.Solutions, s.Steps, s.TotalNodes(), s.TotalUpdates(),
+		sum(s.Choices), s.Covers, s.Uncovers, s.Purifies, s.Unpurifies)
+	if err != nil {
+		return err
+	}
+	for k := range s.Nodes {
+		_, err := fmt.Fprintf(w, "level %d nodes %d updates %d branches %d deadends %d\n",
+			k, s.Nodes[k], s.Updates[k], s.Branches[k], s.DeadEnds[k])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTable writes the stats for each level as an aligned table
+func (s *Stats) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "level\tnodes\tupdates\tupdates/node\tbranching\tdead ends\t\n")
+	for k := range s.Nodes {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%.1f\t%.2f\t%d\t\n", k, s.Nodes[k], s.Updates[k],
+			float64(s.Updates[k])/float64(s.Nodes[k]), s.Branching(k), s.DeadEnds[k])
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t\t\t%d\t\n", s.TotalNodes(), s.TotalUpdates(), sum(s.DeadEnds))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d solutions in %d steps: %d nodes, %d choices, %d covers, %d uncovers, %d purifies, %d unpurifies\n",
+		s.Solutions, s.Steps, s.TotalNodes(), sum(s.Choices), s.Covers, s.Uncovers, s.Purifies, s.Unpurifies)
+	return err
+}
@@ -0,0 +1,361 @@
+package dlx
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+)
+
+// ZDD is a zero-suppressed decision diagram of all the solutions of a
+// problem, built like Knuth's DXZ: algorithm X memoized on the state of the
+// columns, so a subproblem reached by different choices of rows is only
+// solved once.  Node i of the diagram branches on option Nodes[i].Option,
+// with Lo the solutions without it and Hi the ones with it.  Nodes 0 and 1
+// are the terminals for no solutions and for the empty solution.
+type ZDD struct {
+	Nodes []ZNode
+	Root  int
+	count []*big.Int // solutions under each node
+}
+
+type ZNode struct {
+	Option int
+	Lo, Hi int
+}
+
+// the terminals
+const (
+	zddEmpty = 0
+	zddUnit  = 1
+)
+
+// Count is the number of solutions in the diagram
+func (z *ZDD) Count() *big.Int {
+	return new(big.Int).Set(z.count[z.Root])
+}
+
+// Sample picks a solution uniformly at random by walking down from the root,
+// taking each Hi branch in proportion to the solutions under it.  It returns
+// nil when there are no solutions
+func (z *ZDD) Sample(rng *rand.Rand) Solution {
+	if z.count[z.Root].Sign() == 0 {
+		return nil
+	}
+	soln := Solution{}
+	r := new(big.Int)
+	for n := z.Root; n != zddUnit; {
+		node := z.Nodes[n]
+		r.Rand(rng, z.count[n])
+		if r.Cmp(z.count[node.Hi]) < 0 {
+			soln = append(soln, node.Option)
+			n = node.Hi
+		} else {
+			n = node.Lo
+		}
+	}
+	sort.Ints(soln)
+	return soln
+}
+
+// Solutions calls visit with each solution in the diagram until it returns false
+func (z *ZDD) Solutions(visit func(Solution) bool) {
+	var soln Solution
+	var walk func(n int) bool
+	walk = func(n int) bool {
+		for n > zddUnit {
+			node := z.Nodes[n]
+			soln = append(soln, node.Option)
+			ok := walk(node.Hi)
+			soln = soln[:len(soln)-1]
+			if !ok {
+				return false
+			}
+			n = node.Lo
+		}
+		if n == zddEmpty {
+			return true
+		}
+		s := append(Solution{}, soln...)
+		sort.Ints(s)
+		return visit(s)
+	}
+	walk(z.Root)
+}
+
+// ZDD builds the diagram of all the solutions of the problem
+func (p *Problem) ZDD(ctx context.Context) (*ZDD, error) {
+	dl, err := p.Build()
+	if err != nil {
+		return nil, err
+	}
+	return dl.ZDD(ctx)
+}
+
+// ZDD builds the diagram of all the solutions by searching the links, without
+// going into a subproblem that was already built.  The subproblem is known by
+// the state of the columns, so the column chosen at each node only depends
+// on them, whatever the chooser.  Bounded columns are branched on before the
+// others, choosing their rows in order like SetBounds until they take no more,
+// which needs each row to cover at most one bounded column.  Like Search it
+// returns the context's error if cancelled, and the links are restored
+func (dl *DancingLinks) ZDD(ctx context.Context) (*ZDD, error) {
+	for y, r := range dl.rows {
+		n := 0
+		j := r
+		for {
+			if j.C.bounded() {
+				n++
+			}
+			if j = j.R; j == r {
+				break
+			}
+		}
+		if n > 1 {
+			return nil, fmt.Errorf("row %d covers more than one bounded column", y)
+		}
+	}
+	b := &zddBuilder{
+		dl:     dl,
+		z:      &ZDD{Nodes: make([]ZNode, 2)},
+		memo:   make(map[string]int),
+		unique: make(map[ZNode]int),
+		cols:   make([]int, len(dl.cols)),
+		open:   -1,
+		done:   ctx.Done(),
+	}
+	root := b.build()
+	if b.cancelled {
+		return nil, ctx.Err()
+	}
+	z := b.z
+	z.Root = root
+	z.count = make([]*big.Int, len(z.Nodes))
+	z.count[zddEmpty] = big.NewInt(0)
+	z.count[zddUnit] = big.NewInt(1)
+	// nodes are made after the nodes they point to
+	for n := zddUnit + 1; n < len(z.Nodes); n++ {
+		node := z.Nodes[n]
+		z.count[n] = new(big.Int).Add(z.count[node.Lo], z.count[node.Hi])
+	}
+	return z, nil
+}
+
+// builds a ZDD by searching the links.  the state of the search is in cols,
+// 0 for a column that's free, 1 once it's covered and 1 plus the color once
+// it's purified to a color, and in open, the bounded column being branched
+// on, whose rows above cursor have been passed over
+type zddBuilder struct {
+	dl     *DancingLinks
+	z      *ZDD
+	memo   map[string]int // the node for each state already built
+	unique map[ZNode]int  // so equal nodes are shared
+	key    []byte
+
+	cols         []int
+	open, cursor int
+	saved        []int // columns and their states before they were changed
+
+	done      <-chan struct{}
+	cancelled bool
+	ticks     int
+}
+
+// how often the builder checks whether it's cancelled
+const zddTicks = 1 << 10
+
+// the node for the solutions of the current state
+func (b *zddBuilder) build() int {
+	dl := b.dl
+	if dl.root.R == &dl.root.Node {
+		return zddUnit
+	}
+	if b.cancelled {
+		return zddEmpty
+	}
+	key := b.stateKey()
+	if n, ok := b.memo[key]; ok {
+		return n
+	}
+	b.ticks++
+	if b.ticks%zddTicks == 0 {
+		select {
+		case <-b.done:
+			b.cancelled = true
+			return zddEmpty
+		default:
+		}
+	}
+	var n int
+	if c := b.choose(); c.bounded() {
+		n = b.buildBounded(c)
+	} else {
+		n = b.buildColumn(c)
+	}
+	b.memo[key] = n
+	return n
+}
+
+// the open column, or the bounded column with the fewest branches, or the
+// column with the fewest rows
+func (b *zddBuilder) choose() *Column {
+	dl := b.dl
+	dl.S++
+	if b.open >= 0 {
+		return dl.cols[b.open]
+	}
+	var c *Column
+	for col := dl.root.R; col != &dl.root.Node; col = col.R {
+		if col.C.bounded() && (c == nil || col.C.Size() < c.Size()) {
+			c = col.C
+		}
+	}
+	if c == nil {
+		c = MRV{}.Choose(dl)
+	}
+	return c
+}
+
+// branches on unbounded column c.  the lo branches chain through the rows of
+// the column, each taking the solutions with one of them
+func (b *zddBuilder) buildColumn(c *Column) int {
+	dl := b.dl
+	var rows, his []int
+	dl.cover(c)
+	mark := len(b.saved)
+	b.set(c.x, 1)
+	for r := c.D; r != &c.Node; r = r.D {
+		mark := b.commit(r)
+		rows = append(rows, r.y)
+		his = append(his, b.build())
+		b.uncommit(r, mark)
+	}
+	b.unset(mark)
+	dl.uncover(c)
+	return b.chain(rows, his, zddEmpty)
+}
+
+// branches on bounded column c: each of its rows left can be the next one
+// chosen for it, passing over the rows above, or it takes no more rows
+func (b *zddBuilder) buildBounded(c *Column) int {
+	dl := b.dl
+	if c.branches() <= 0 {
+		return zddEmpty
+	}
+	open, cursor := b.open, b.cursor
+	var rows, his []int
+	var nodes []*Node
+	for r := c.D; r != &c.Node; r = r.D {
+		nodes = append(nodes, r)
+	}
+	for _, r := range nodes {
+		dl.remove(r)
+		dl.use(c)
+		mark := b.commit(r)
+		if c.used == c.hi {
+			b.set(c.x, 1)
+			b.open = -1
+		} else {
+			b.open, b.cursor = c.x, r.y+1
+		}
+		rows = append(rows, r.y)
+		his = append(his, b.build())
+		b.uncommit(r, mark)
+		dl.unuse(c)
+		b.open, b.cursor = open, cursor
+	}
+	stop := zddEmpty
+	if c.used >= c.lo {
+		dl.cover(c)
+		mark := len(b.saved)
+		b.set(c.x, 1)
+		b.open = -1
+		stop = b.build()
+		b.unset(mark)
+		b.open = open
+		dl.uncover(c)
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		dl.restore(nodes[i])
+	}
+	return b.chain(rows, his, stop)
+}
+
+// the node choosing one of the rows, with his the node after choosing each,
+// or lo if none of them is
+func (b *zddBuilder) chain(rows, his []int, lo int) int {
+	n := lo
+	for i := len(rows) - 1; i >= 0; i-- {
+		n = b.node(rows[i], n, his[i])
+	}
+	return n
+}
+
+// commits row r and marks its columns covered or purified.  returns the mark
+// to uncommit back to
+func (b *zddBuilder) commit(r *Node) int {
+	mark := len(b.saved)
+	b.dl.commitRow(r)
+	for j := r.R; j != r; j = j.R {
+		if j.C.bounded() {
+			continue
+		}
+		if j.color == 0 {
+			b.set(j.x, 1)
+		} else if j.color > 0 {
+			b.set(j.x, 1+j.color)
+		}
+	}
+	return mark
+}
+
+func (b *zddBuilder) uncommit(r *Node, mark int) {
+	b.unset(mark)
+	b.dl.uncommitRow(r)
+}
+
+func (b *zddBuilder) set(x, v int) {
+	b.saved = append(b.saved, x, b.cols[x])
+	b.cols[x] = v
+}
+
+// restores the columns set since mark
+func (b *zddBuilder) unset(mark int) {
+	for i := len(b.saved) - 2; i >= mark; i -= 2 {
+		b.cols[b.saved[i]] = b.saved[i+1]
+	}
+	b.saved = b.saved[:mark]
+}
+
+// the node for option y, sharing an equal one if it's been made.  a node
+// whose hi branch has no solutions is suppressed
+func (b *zddBuilder) node(y, lo, hi int) int {
+	if hi == zddEmpty {
+		return lo
+	}
+	node := ZNode{Option: y, Lo: lo, Hi: hi}
+	if n, ok := b.unique[node]; ok {
+		return n
+	}
+	n := len(b.z.Nodes)
+	b.z.Nodes = append(b.z.Nodes, node)
+	b.unique[node] = n
+	return n
+}
+
+func (b *zddBuilder) stateKey() string {
+	key := b.key[:0]
+	for _, v := range b.cols {
+		key = binary.AppendUvarint(key, uint64(v))
+	}
+	if b.open >= 0 {
+		c := b.dl.cols[b.open]
+		key = binary.AppendUvarint(key, uint64(c.x))
+		key = binary.AppendUvarint(key, uint64(c.used))
+		key = binary.AppendUvarint(key, uint64(b.cursor))
+	}
+	b.key = key
+	return string(key)
+}
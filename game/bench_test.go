@@ -0,0 +1,30 @@
+package game
+
+import "testing"
+
+// the cubes from the README, which are slow to set up with many placements
+var benchCubes = []struct {
+	name, file string
+	w, h, d    int
+	spec       string
+}{
+	{"3x4x5", "../data/pentominoes.txt", 3, 4, 5, "FILNPTUVWXYZ"},
+	{"4x4x4", "../data/gagne.txt", 4, 4, 4, "oOvVzZiIlLnpstrY"},
+}
+
+func BenchmarkNewCube(b *testing.B) {
+	for _, c := range benchCubes {
+		lib, err := LoadLibrary(c.file, true)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewCube(lib, c.w, c.h, c.d, c.spec); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
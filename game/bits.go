@@ -0,0 +1,100 @@
+package game
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// the cells of a grid packed 64 to a word, so whole grids can be compared,
+// combined and counted a word at a time.  the bits past the last cell are
+// always 0
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) get(i int) bool {
+	return b[i/64]&(1<<(i%64)) != 0
+}
+
+func (b bitset) set(i int, v bool) {
+	if v {
+		b[i/64] |= 1 << (i % 64)
+	} else {
+		b[i/64] &^= 1 << (i % 64)
+	}
+}
+
+func (b bitset) empty() bool {
+	for _, w := range b {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b bitset) equals(o bitset) bool {
+	if len(b) != len(o) {
+		return false
+	}
+	for i := range b {
+		if b[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// the number of cells that are set
+func (b bitset) count() int {
+	n := 0
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+func (b bitset) union(o bitset) bitset {
+	u := make(bitset, len(b))
+	for i := range b {
+		u[i] = b[i] | o[i]
+	}
+	return u
+}
+
+func (b bitset) intersect(o bitset) bitset {
+	u := make(bitset, len(b))
+	for i := range b {
+		u[i] = b[i] & o[i]
+	}
+	return u
+}
+
+func (b bitset) minus(o bitset) bitset {
+	u := make(bitset, len(b))
+	for i := range b {
+		u[i] = b[i] &^ o[i]
+	}
+	return u
+}
+
+// the index of each cell that's set, in order
+func (b bitset) indexes() []int {
+	is := make([]int, 0, b.count())
+	for i, w := range b {
+		for w != 0 {
+			is = append(is, i*64+bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+	return is
+}
+
+func (b bitset) appendKey(key []byte) []byte {
+	for _, w := range b {
+		key = binary.LittleEndian.AppendUint64(key, w)
+	}
+	return key
+}
@@ -9,6 +9,7 @@ type Play struct {
 	Piece *Piece
 	Grid  *Grid // piece as oriented on board
 	X, Y  int   // position on board
+	Fixed bool  // laid out before solving
 }
 
 func (p *Play) String() string {
@@ -17,24 +18,125 @@ func (p *Play) String() string {
 
 type Board struct {
 	W, H     int
+	Mask     *Grid // the cells of the board, or nil for the whole w x h
 	pieces   []*Piece
+	bounds   []Bound
+	debug    DebugOptions
+	Fixed    []*Play // the pieces laid out before solving
+	cells    []int   // the cell y*W + x of each cell column
 	Coverage *Coverage
 }
 
-func NewBoard(w, h int, piecesSpec string) *Board {
+// NewBoard makes a w x h board to play the pieces of the spec from the library.
+// a bad spec is an *UnknownPieceError or a *SpecError, which it also is if a
+// piece isn't flat
+func NewBoard(lib *Library, w, h int, piecesSpec string) (*Board, error) {
+	return newBoard(lib, w, h, nil, nil, piecesSpec)
+}
+
+// NewMaskedBoard makes a board of the cells set in the mask, like NewBoard.
+// the pieces are only played inside the mask
+func NewMaskedBoard(lib *Library, mask *Grid, piecesSpec string) (*Board, error) {
+	return newBoard(lib, mask.W, mask.H, mask, nil, piecesSpec)
+}
+
+// NewPartialBoard makes a board of the layout, or of the cells set in the mask
+// with the layout over it if the mask isn't nil, like NewMaskedBoard.  the
+// blocked cells are left out of the board, and the pieces fixed in the layout
+// are played where they are, taking their copies from the spec.  the solutions
+// play the rest of the pieces on the rest of the cells.  a layout that doesn't
+// fit is a *ParseError
+func NewPartialBoard(lib *Library, layout *Layout, mask *Grid, piecesSpec string) (*Board, error) {
+	if mask != nil && (mask.W != layout.W || mask.H != layout.H) {
+		return nil, &ParseError{File: layout.file, Line: layout.lines[0], Reason: fmt.Sprintf("the layout is %dx%d, not %dx%d like the mask", layout.W, layout.H, mask.W, mask.H)}
+	}
+	board := newEmptyGrid(layout.W, layout.H)
+	for y := 0; y < layout.H; y++ {
+		for x := 0; x < layout.W; x++ {
+			in := mask == nil || mask.Get(x, y)
+			if !in && !layout.open(x, y) && !layout.blocked(x, y) {
+				return nil, &ParseError{File: layout.file, Line: layout.lines[y], Reason: fmt.Sprintf("piece %c is off the board at cell %d of the row", layout.rows[y][x], x+1)}
+			}
+			board.Set(x, y, in && !layout.blocked(x, y))
+		}
+	}
+	fixed, err := layout.plays(lib)
+	if err != nil {
+		return nil, err
+	}
+	return newBoard(lib, layout.W, layout.H, board, fixed, piecesSpec)
+}
+
+func newBoard(lib *Library, w, h int, mask *Grid, fixed []*Play, piecesSpec string) (*Board, error) {
+	pieces, bounds, err := lib.parsePiecesSpec(piecesSpec)
+	if err != nil {
+		return nil, err
+	}
+	for _, piece := range pieces {
+		if !piece.Flat() {
+			return nil, &SpecError{Spec: piecesSpec, Reason: fmt.Sprintf("piece %s isn't flat, so it can't be played on a board", piece.Name)}
+		}
+	}
+	if pieces, bounds, err = takeFixed(piecesSpec, pieces, bounds, fixed); err != nil {
+		return nil, err
+	}
 	b := &Board{
-		pieces: parsePiecesSpec(piecesSpec),
+		pieces: pieces,
+		bounds: bounds,
+		debug:  lib.debug,
 		W:      w,
 		H:      h,
+		Mask:   mask,
+		Fixed:  fixed,
 	}
 	b.Coverage = newBoardCoverage(b)
-	return b
+	return b, nil
+}
+
+// takes the copies of the fixed pieces out of the bounds of the pieces, leaving
+// out a piece once all its copies are fixed.  a piece that's fixed more times
+// than the spec has it is a *SpecError
+func takeFixed(piecesSpec string, pieces []*Piece, bounds []Bound, fixed []*Play) ([]*Piece, []Bound, error) {
+	if len(fixed) == 0 {
+		return pieces, bounds, nil
+	}
+	index := make(map[*Piece]int)
+	for i, piece := range pieces {
+		index[piece] = i
+	}
+	bounds = append([]Bound{}, bounds...)
+	for _, play := range fixed {
+		i, ok := index[play.Piece]
+		if !ok {
+			return nil, nil, &SpecError{Spec: piecesSpec, Reason: fmt.Sprintf("piece %s is laid out but isn't in the spec", play.Piece.Name)}
+		}
+		if bounds[i].Max == 0 {
+			return nil, nil, &SpecError{Spec: piecesSpec, Reason: fmt.Sprintf("piece %s is laid out more times than the spec has it", play.Piece.Name)}
+		}
+		bounds[i].Max--
+		if bounds[i].Min > 0 {
+			bounds[i].Min--
+		}
+	}
+	var (
+		left       []*Piece
+		leftBounds []Bound
+	)
+	for i, piece := range pieces {
+		if bounds[i].Max > 0 {
+			left = append(left, piece)
+			leftBounds = append(leftBounds, bounds[i])
+		}
+	}
+	return left, leftBounds, nil
 }
 
 // play a DLX solution by reading the selected rows
 // from the coverage data
-// returns a list of plays that represent the placement of each piece
+// returns a list of plays that represent the placement of each piece,
+// starting with the fixed pieces
 func (b *Board) Play(rows []int) (plays []*Play) {
+	plays = append(plays, b.Fixed...)
 	for _, y := range rows {
 		plays = append(plays, b.play(y))
 	}
@@ -44,7 +146,7 @@ func (b *Board) Play(rows []int) (plays []*Play) {
 func (b *Board) play(y int) *Play {
 	play := &Play{}
 	p := len(b.pieces)
-	row := b.Coverage.M.Row(y)
+	row := b.Coverage.Row(y)
 	//
 	// scan for the piece
 	for i := 0; i < p; i++ {
@@ -57,24 +159,36 @@ func (b *Board) play(y int) *Play {
 	// rebuild the grid from the coverage row
 	grid := newEmptyGrid(b.W, b.H)
 	for i := p; i < len(row); i++ {
-		x := (i - p) % b.W
-		y := (i - p) / b.W
-		grid.Set(x, y, row[i])
+		cell := b.cells[i-p]
+		grid.Set(cell%b.W, cell/b.W, row[i])
 	}
+	//
+	// trim the grid to the subgrid bounding the piece
+	play.X, play.Y, play.Grid = trim(grid)
+	if b.debug.piece(play.Piece) {
+		fmt.Printf("play of %s at (%d, %d) w=%d, h=%d:\n", play.Piece.Name, play.X, play.Y, play.Grid.W, play.Grid.H)
+		fmt.Println(play)
+		fmt.Println(grid)
+	}
+	return play
+}
+
+// the position of the cells set in the grid and the subgrid bounding them
+func trim(grid *Grid) (x, y int, sub *Grid) {
 	//
 	// scan for piece location and extents
 	w, h := 0, 0
 	found := false
-	for y := 0; y < b.H; y++ {
+	for j := 0; j < grid.H; j++ {
 		if found {
-			if grid.IsRowEmpty(y) {
+			if grid.IsRowEmpty(j) {
 				break
 			} else {
 				h++
 			}
 		} else {
-			if grid.IsRowEmpty(y) {
-				play.Y++
+			if grid.IsRowEmpty(j) {
+				y++
 			} else {
 				h++
 				found = true
@@ -82,28 +196,21 @@ func (b *Board) play(y int) *Play {
 		}
 	}
 	found = false
-	for x := 0; x < b.W; x++ {
+	for i := 0; i < grid.W; i++ {
 		if found {
-			if grid.IsColEmpty(x) {
+			if grid.IsColEmpty(i) {
 				break
 			} else {
 				w++
 			}
 		} else {
-			if grid.IsColEmpty(x) {
-				play.X++
+			if grid.IsColEmpty(i) {
+				x++
 			} else {
 				w++
 				found = true
 			}
 		}
 	}
-	// trim the grid to the subgrid bounding the piece
-	play.Grid = grid.GetSubgrid(play.X, play.Y, w, h)
-	if debug.piece(play.Piece) {
-		fmt.Printf("play of %s at (%d, %d) w=%d, h=%d:\n", play.Piece.Name, play.X, play.Y, w, h)
-		fmt.Println(play)
-		fmt.Println(grid)
-	}
-	return play
+	return x, y, grid.GetSubgrid(x, y, w, h)
 }
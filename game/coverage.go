@@ -3,6 +3,7 @@ package game
 import (
 	"bytes"
 	"fmt"
+	"github.com/leonprime/byf/dlx"
 	"strings"
 )
 
@@ -14,63 +15,173 @@ type Debug struct {
 }
 
 // the coverage matrix, its column names, and any coverage debugging
+// the first Pieces columns are for the pieces, the rest are for the cells.
+// the rows of the matrix are kept sparse in Options, as the list of columns
+// each covers in order, with the piece column first.
+// Bounds are how many times each piece column is covered.
+// columns marked in Secondary may be covered at most once instead of exactly once,
+// or shared by rows that agree on the color label in Colors, which is indexed like Options
 type Coverage struct {
-	Columns []string
-	M       *Grid
-	Debugs  []*Debug
+	Columns   []string
+	Secondary []bool
+	Colors    [][]string
+	Pieces    int
+	Bounds    []Bound
+	Options   [][]int
+	Debugs    []*Debug
+}
+
+// the dense row y of the coverage matrix
+func (c *Coverage) Row(y int) []bool {
+	row := make([]bool, len(c.Columns), len(c.Columns))
+	for _, x := range c.Options[y] {
+		row[x] = true
+	}
+	return row
+}
+
+// lets a solution leave pieces out.  pieces used at most once get secondary
+// columns and pieces with a count can be used anywhere from none to the count.
+// secondary columns keep the bounds of 1, since they can't have bounds
+func (c *Coverage) OptionalPieces() {
+	for i, bound := range c.Bounds {
+		if bound.Max == 1 {
+			c.setSecondary(i, i+1)
+		} else {
+			c.Bounds[i].Min = 0
+		}
+	}
+}
+
+// makes the cell columns secondary so a solution can leave some cells empty
+func (c *Coverage) OptionalCells() {
+	c.setSecondary(c.Pieces, len(c.Columns))
+}
+
+func (c *Coverage) setSecondary(from, to int) {
+	if c.Secondary == nil {
+		c.Secondary = make([]bool, len(c.Columns), len(c.Columns))
+	}
+	for i := from; i < to; i++ {
+		c.Secondary[i] = true
+	}
+}
+
+// the coverage as an exact cover problem
+func (c *Coverage) Problem() *dlx.Problem {
+	p := &dlx.Problem{
+		Columns:   c.Columns,
+		Secondary: c.Secondary,
+		Options:   c.Options,
+		Colors:    c.Colors,
+	}
+	bounded := false
+	for _, bound := range c.Bounds {
+		bounded = bounded || bound.Min != 1 || bound.Max != 1
+	}
+	if bounded {
+		p.Lo = make([]int, len(c.Columns))
+		p.Hi = make([]int, len(c.Columns))
+		for x := range p.Lo {
+			p.Lo[x], p.Hi[x] = 1, 1
+		}
+		for x, bound := range c.Bounds {
+			p.Lo[x], p.Hi[x] = bound.Min, bound.Max
+		}
+	}
+	return p
 }
 
 // converts a board game into a coverage matrix for solving with DLX
 // this flattens a 2D game board by listing one row after another
 func newBoardCoverage(b *Board) *Coverage {
 	var (
-		rows  [][]bool
-		names []string
+		options [][]int
+		names   []string
 	)
 	n := len(b.pieces)
+	// the cells left to cover, without the fixed pieces, which are only on
+	// a masked board
+	free := b.Mask
+	for _, play := range b.Fixed {
+		placed := newEmptyGrid(b.W, b.H)
+		placed.SetSubgrid(play.X, play.Y, play.Grid)
+		free = free.Minus(placed)
+	}
+	var mask bitset
+	if free != nil {
+		mask = free.cells
+	}
+	var columns []int
+	b.cells, columns = cellColumns(n, b.W*b.H, mask)
 	for i, piece := range b.pieces {
-		grids := piece.Positions(b.W, b.H)
-		if debug.piece(piece) {
+		var grids []*Grid
+		for _, grid := range piece.Positions(b.W, b.H) {
+			// only the positions inside the mask
+			if free == nil || grid.Intersect(free).Count() == grid.Count() {
+				grids = append(grids, grid)
+			}
+		}
+		if b.debug.piece(piece) {
 			printperms(piece, grids)
 		}
 		for _, grid := range grids {
-			row := make([]bool, n, n)
-			row[i] = true // set piece at index i to 1
-			for y := 0; y < b.H; y++ {
-				for x := 0; x < b.W; x++ {
-					row = append(row, grid.Get(x, y))
-				}
+			option := make([]int, 1, 1+grid.Count())
+			option[0] = i // the piece at index i
+			// the cells are in the order of their columns
+			for _, cell := range grid.Indexes() {
+				option = append(option, columns[cell])
 			}
-			rows = append(rows, row)
+			options = append(options, option)
 		}
 		// also set the name
 		names = append(names, piece.Name)
 	}
-	// rest of the columns should be named sequentially y*h + x
-	for y := 0; y < b.H; y++ {
-		for x := 0; x < b.W; x++ {
-			names = append(names, fmt.Sprintf("c%d", y*b.H+x))
-		}
+	// rest of the columns are named by their cells y*w + x
+	for _, cell := range b.cells {
+		names = append(names, fmt.Sprintf("c%d", cell))
 	}
 	cov := &Coverage{
-		M:       &Grid{Cells: rows, W: len(rows[0]), H: len(rows)},
+		Options: options,
 		Columns: names,
+		Pieces:  n,
+		Bounds:  b.bounds,
 	}
-	if debug.coverage() {
+	if b.debug.coverage() {
 		fmt.Println(cov)
 	}
 	return cov
 }
 
+// the cell of each cell column, which are the cells set in the mask, or all
+// size of them if it's nil, and the column of each cell after the n pieces
+func cellColumns(n, size int, mask bitset) (cells, columns []int) {
+	if mask == nil {
+		cells = make([]int, size)
+		for i := range cells {
+			cells[i] = i
+		}
+	} else {
+		cells = mask.indexes()
+	}
+	columns = make([]int, size)
+	for x, cell := range cells {
+		columns[cell] = n + x
+	}
+	return cells, columns
+}
+
 // returns all uniquely oriented positions of the piece
 // on a 2D game board reprsented by (w, h),
 func (p *Piece) Positions(w, h int) []*Grid {
 	var grids []*Grid
+	seen := make(map[string]bool)
 	for _, shape := range p.Shapes {
-		grids = append(grids, perms(w, h, shape)...)
-		for i := 1; i < p.Rotate; i++ {
-			shape = shape.Rotate()
-			grids = append(grids, perms(w, h, shape)...)
+		for _, grid := range perms(w, h, shape) {
+			if key := grid.key(); !seen[key] {
+				seen[key] = true
+				grids = append(grids, grid)
+			}
 		}
 	}
 	return grids
@@ -118,28 +229,37 @@ func printperms(p *Piece, grids []*Grid) {
 // from front to back in Z
 func newCubeCoverage(c *Cube) *Coverage {
 	var (
-		rows   [][]bool
-		names  []string
-		debugs []*Debug
+		options [][]int
+		names   []string
+		debugs  []*Debug
 	)
 	n := len(c.pieces)
+	var mask bitset
+	if c.Mask != nil {
+		mask = c.Mask.cells
+	}
+	var columns []int
+	c.cells, columns = cellColumns(n, c.W*c.H*c.D, mask)
 	for i, piece := range c.pieces {
-		grids := piece.Positions3D(c.W, c.H, c.D)
+		var grids []*Grid3D
+		for _, grid := range piece.positions3D(c.W, c.H, c.D, &c.debug) {
+			// only the positions inside the mask
+			if c.Mask == nil || grid.Intersect(c.Mask).Count() == grid.Count() {
+				grids = append(grids, grid)
+			}
+		}
 		for _, grid := range grids {
-			row := make([]bool, n, n)
-			row[i] = true // set piece at index i to 1
-			for z := 0; z < c.D; z++ {
-				for y := 0; y < c.H; y++ {
-					for x := 0; x < c.W; x++ {
-						row = append(row, grid.Get(x, y, z))
-					}
-				}
+			option := make([]int, 1, 1+grid.Count())
+			option[0] = i // the piece at index i
+			// the cells are in the order of their columns
+			for _, cell := range grid.Indexes() {
+				option = append(option, columns[cell])
 			}
-			rows = append(rows, row)
+			options = append(options, option)
 		}
 		// also set the name
 		names = append(names, piece.Name)
-		if debug.piece(piece) {
+		if c.debug.piece(piece) {
 			var plays []*Play3D
 			for _, grid := range grids {
 				plays = append(plays, &Play3D{Piece: piece, Grid: grid})
@@ -147,20 +267,18 @@ func newCubeCoverage(c *Cube) *Coverage {
 			debugs = append(debugs, &Debug{Name: fmt.Sprintf("positions_%s", piece.Name), Plays: plays, W: c.W, H: c.H, D: c.D})
 		}
 	}
-	// rest of the columns should be named sequentially z*w*h + y*h + x
-	for y := 0; y < c.H; y++ {
-		for x := 0; x < c.W; x++ {
-			for z := 0; z < c.D; z++ {
-				names = append(names, fmt.Sprintf("c%d", z*c.W*c.H+y*c.H+x))
-			}
-		}
+	// rest of the columns are named by their cells z*w*h + y*w + x
+	for _, cell := range c.cells {
+		names = append(names, fmt.Sprintf("c%d", cell))
 	}
 	cov := &Coverage{
-		M:       &Grid{Cells: rows, W: len(rows[0]), H: len(rows)},
+		Options: options,
 		Columns: names,
+		Pieces:  n,
+		Bounds:  c.bounds,
 		Debugs:  debugs,
 	}
-	if debug.coverage() {
+	if c.debug.coverage() {
 		fmt.Println(cov)
 	}
 	return cov
@@ -169,82 +287,44 @@ func newCubeCoverage(c *Cube) *Coverage {
 // returns all uniquely oriented positions of the piece
 // on a 3d cube reprsented by (w, h, d),
 func (p *Piece) Positions3D(w, h, d int) []*Grid3D {
+	return p.positions3D(w, h, d, &DebugOptions{})
+}
+
+func (p *Piece) positions3D(w, h, d int, debug *DebugOptions) []*Grid3D {
 	//
-	// The key to this is to use the 2D position permutations in each dimension
-	// and "project" them. There can be duplicates, so must clean that up too.
-	var (
-		grids   []*Grid3D
-		grids2d []*Grid
-	)
-	// plane xy down z
-	grids2d = p.Positions(w, h)
-	if debug.piece(p) {
-		fmt.Println("plane xy down z:")
-		printperms(p, grids2d)
-	}
-	for _, grid2d := range grids2d {
-		for z := 0; z < d; z++ {
-			grid := newEmptyGrid3D(w, h, d)
-			grid.SetPlaneZ(z, grid2d)
-			found := false
-			for _, test := range grids {
-				if grid.Equals(test) {
-					found = true
-					break
-				}
-			}
-			if !found {
+	// place each orientation everywhere it fits.  a shape drawn with an empty
+	// edge can have orientations that make the same placements, so must clean
+	// that up too, keeping the placements seen by their keys.
+	var grids []*Grid3D
+	seen := make(map[string]bool)
+	for _, shape := range p.Shapes3D {
+		for _, grid := range perms3D(w, h, d, shape) {
+			if key := grid.key(); !seen[key] {
+				seen[key] = true
 				grids = append(grids, grid)
 			}
 		}
 	}
-	// plane xz down y
-	grids2d = p.Positions(w, d)
 	if debug.piece(p) {
-		fmt.Println("plane xz down y:")
-		printperms(p, grids2d)
-	}
-	for _, grid2d := range grids2d {
-		for y := 0; y < h; y++ {
-			grid := newEmptyGrid3D(w, h, d)
-			grid.SetPlaneY(y, grid2d)
-			found := false
-			for _, test := range grids {
-				if grid.Equals(test) {
-					found = true
-					break
-				}
-			}
-			if !found {
-				grids = append(grids, grid)
-			}
-		}
-	}
-	// plane zy down x
-	grids2d = p.Positions(d, h)
-	if debug.piece(p) {
-		fmt.Println("plane zy down x:")
-		printperms(p, grids2d)
+		fmt.Printf("generated %d 3D positions for %s\n", len(grids), p.Name)
 	}
-	for _, grid2d := range grids2d {
-		for x := 0; x < w; x++ {
-			grid := newEmptyGrid3D(w, h, d)
-			grid.SetPlaneX(x, grid2d)
-			found := false
-			for _, test := range grids {
-				if grid.Equals(test) {
-					found = true
-					break
+	return grids
+}
+
+// like perms, for a shape in a cube
+func perms3D(w, h, d int, shape *Grid3D) []*Grid3D {
+	var grids []*Grid3D
+	for z := 0; z+shape.D <= d; z++ {
+		for y := 0; y+shape.H <= h; y++ {
+			for x := 0; x+shape.W <= w; x++ {
+				grid := newEmptyGrid3D(w, h, d)
+				grid.SetSubgrid(x, y, z, shape)
+				if !grid.IsEmpty() {
+					grids = append(grids, grid)
 				}
 			}
-			if !found {
-				grids = append(grids, grid)
-			}
 		}
 	}
-	if debug.piece(p) {
-		fmt.Printf("generated %d 3D positions for %s\n", len(grids), p.Name)
-	}
 	return grids
 }
 
@@ -256,14 +336,17 @@ func (c *Coverage) String() string {
 		b.WriteString(" ")
 	}
 	b.WriteRune('\n')
-	b.WriteString(c.M.String())
+	for y := range c.Options {
+		b.WriteString(c.RowString(y))
+		b.WriteRune('\n')
+	}
 	return b.String()
 }
 
 func (c *Coverage) RowString(y int) string {
 	var b bytes.Buffer
-	for i, v := range c.M.Row(y) {
-		if i == len(c.Columns) {
+	for i, v := range c.Row(y) {
+		if i == c.Pieces {
 			b.WriteString(" : ")
 		}
 		if v {
@@ -14,19 +14,41 @@ func (p *Play3D) String() string {
 
 type Cube struct {
 	W, H, D  int
+	Mask     *Grid3D // the cells of the cube, or nil for the whole w x h x d
 	pieces   []*Piece
+	bounds   []Bound
+	debug    DebugOptions
+	cells    []int // the cell (z*H + y)*W + x of each cell column
 	Coverage *Coverage
 }
 
-func NewCube(w, h, d int, piecesSpec string) *Cube {
+// NewCube makes a w x h x d cube to play the pieces of the spec from the library
+// like NewBoard
+func NewCube(lib *Library, w, h, d int, piecesSpec string) (*Cube, error) {
+	return newCube(lib, w, h, d, nil, piecesSpec)
+}
+
+// NewMaskedCube makes a cube of the cells set in the mask, like NewMaskedBoard
+func NewMaskedCube(lib *Library, mask *Grid3D, piecesSpec string) (*Cube, error) {
+	return newCube(lib, mask.W, mask.H, mask.D, mask, piecesSpec)
+}
+
+func newCube(lib *Library, w, h, d int, mask *Grid3D, piecesSpec string) (*Cube, error) {
+	pieces, bounds, err := lib.parsePiecesSpec(piecesSpec)
+	if err != nil {
+		return nil, err
+	}
 	c := &Cube{
-		pieces: parsePiecesSpec(piecesSpec),
+		pieces: pieces,
+		bounds: bounds,
+		debug:  lib.debug,
 		W:      w,
 		H:      h,
 		D:      d,
+		Mask:   mask,
 	}
 	c.Coverage = newCubeCoverage(c)
-	return c
+	return c, nil
 }
 
 func (c *Cube) Play(rows []int) (plays []*Play3D) {
@@ -39,7 +61,7 @@ func (c *Cube) Play(rows []int) (plays []*Play3D) {
 func (c *Cube) play(y int) *Play3D {
 	play := &Play3D{}
 	p := len(c.pieces)
-	row := c.Coverage.M.Row(y)
+	row := c.Coverage.Row(y)
 	//
 	// scan for the piece
 	for i := 0; i < p; i++ {
@@ -52,12 +74,13 @@ func (c *Cube) play(y int) *Play3D {
 	// rebuild the grid from the coverage row
 	grid := newEmptyGrid3D(c.W, c.H, c.D)
 	for i := p; i < len(row); i++ {
-		x := (i - p) % c.W
-		y := ((i - p) % (c.W * c.H)) / c.W
-		z := (i - p) / (c.W * c.H)
+		cell := c.cells[i-p]
+		x := cell % c.W
+		y := (cell % (c.W * c.H)) / c.W
+		z := cell / (c.W * c.H)
 		grid.Set(x, y, z, row[i])
 	}
-	if debug.piece(play.Piece) {
+	if c.debug.piece(play.Piece) {
 		fmt.Printf("%s grid rebuilt from coverage row:\n", play.Piece.Name)
 		fmt.Println(c.Coverage.RowString(y))
 		fmt.Println(grid)
@@ -118,7 +141,7 @@ func (c *Cube) play(y int) *Play3D {
 	}
 	// trim the grid to the subgrid bounding the piece
 	play.Grid = grid.GetSubgrid(play.X, play.Y, play.Z, w, h, d)
-	if debug.piece(play.Piece) {
+	if c.debug.piece(play.Piece) {
 		fmt.Printf("play geometry: (%d, %d, %d) w=%d, h=%d, d=%d\n", play.X, play.Y, play.Z, w, h, d)
 		fmt.Println(play)
 	}
@@ -1,35 +1,49 @@
 package game
 
-var debug *debugOpts = &debugOpts{}
-
-type debugOpts struct {
-	cov, allPieces bool
-	p              *Piece
+// DebugOptions choose what a Library prints while it builds games
+type DebugOptions struct {
+	Coverage  bool   // the coverage matrix
+	AllPieces bool   // the positions and plays of every piece
+	Piece     string // the positions and plays of the piece with this name
 }
 
-func SetDebugAllPieces() {
-	debug.allPieces = true
+func (d *DebugOptions) piece(p *Piece) bool {
+	if d.AllPieces {
+		return true
+	}
+	return d.Piece != "" && d.Piece == p.Name
 }
 
-func SetDebugPiece(p string) {
-	if piece, ok := allPieces[p]; ok {
-		debug.p = piece
-	} else {
-		panic("piece not found: " + p)
-	}
+func (d *DebugOptions) coverage() bool {
+	return d.Coverage
 }
 
-func SetDebugCoverage() {
-	debug.cov = true
+// SetDebugAllPieces debugs all pieces of the games made from now on with the
+// library loaded by LoadPieces.  like the other SetDebug helpers, it swaps
+// Default for a copy made by WithDebug, so games already made are left alone
+func SetDebugAllPieces() {
+	debug := std.debug
+	debug.AllPieces = true
+	std, _ = std.WithDebug(debug)
 }
 
-func (d *debugOpts) piece(p *Piece) bool {
-	if d.allPieces {
-		return true
+// SetDebugPiece debugs a piece of the library loaded by LoadPieces.  it's an
+// *UnknownPieceError if there's no such piece
+func SetDebugPiece(p string) error {
+	debug := std.debug
+	debug.Piece = p
+	lib, err := std.WithDebug(debug)
+	if err != nil {
+		return err
 	}
-	return d.p == p
+	std = lib
+	return nil
 }
 
-func (d *debugOpts) coverage() bool {
-	return d.cov
+// SetDebugCoverage debugs the coverage matrices made with the library loaded
+// by LoadPieces
+func SetDebugCoverage() {
+	debug := std.debug
+	debug.Coverage = true
+	std, _ = std.WithDebug(debug)
 }
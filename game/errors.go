@@ -0,0 +1,51 @@
+package game
+
+import "fmt"
+
+// UnknownPieceError is a piece named in a pieceSpec or debug option that
+// isn't in the library
+type UnknownPieceError struct {
+	Name string
+}
+
+func (e *UnknownPieceError) Error() string {
+	return fmt.Sprintf("no piece %q defined", e.Name)
+}
+
+// SpecError is a pieceSpec that can't be parsed
+type SpecError struct {
+	Spec   string
+	Reason string
+}
+
+func (e *SpecError) Error() string {
+	return fmt.Sprintf("bad pieceSpec %s: %s", e.Spec, e.Reason)
+}
+
+// ParseError is a bad line of a piece, mask or layout file
+type ParseError struct {
+	File   string // empty when it isn't read from a file
+	Line   int    // counting from 1
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Reason)
+}
+
+// OOBError is an access to a cell outside a grid.  Z and D are 0 for a 2D grid
+type OOBError struct {
+	Op      string
+	X, Y, Z int
+	W, H, D int
+}
+
+func (e *OOBError) Error() string {
+	if e.D == 0 {
+		return fmt.Sprintf("Grid.%s(%d, %d) is oob: Grid(w=%d, h=%d)", e.Op, e.X, e.Y, e.W, e.H)
+	}
+	return fmt.Sprintf("Grid.%s(%d, %d, %d) is oob: Grid(w=%d, h=%d, d=%d)", e.Op, e.X, e.Y, e.Z, e.W, e.H, e.D)
+}
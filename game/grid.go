@@ -2,18 +2,19 @@ package game
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"unicode"
 )
 
 type Grid struct {
-	Cells [][]bool // y, x
 	W, H  int
+	cells bitset // the cell at (x, y) is bit y*W + x
 }
 
-// build a grid from a grid spec, which is a # or █ for true and a . for false
+// build a grid from a grid spec, which is a █ for true and a . for false
 // put each row on a separate line
-func newGrid(spec string) *Grid {
+func newGrid(spec string) (*Grid, error) {
 	cells := make([][]bool, 0, 0)
 	row := make([]bool, 0, 0)
 	for _, char := range spec {
@@ -25,7 +26,7 @@ func newGrid(spec string) *Grid {
 			continue
 		}
 		switch char {
-		case '#', '█':
+		case '█':
 			row = append(row, true)
 		case '.':
 			row = append(row, false)
@@ -37,20 +38,22 @@ func newGrid(spec string) *Grid {
 	w := 0
 	for r := range cells {
 		if w > 0 && w != len(cells[r]) {
-			panic(fmt.Sprintf("grid spec is not rectangular:\n%s", spec))
+			return nil, fmt.Errorf("grid spec is not rectangular:\n%s", spec)
 		}
 		w = len(cells[r])
 	}
-	return &Grid{Cells: cells, W: w, H: len(cells)}
+	g := newEmptyGrid(w, len(cells))
+	for y := range cells {
+		for x, b := range cells[y] {
+			g.Set(x, y, b)
+		}
+	}
+	return g, nil
 }
 
 // returns grid set to false
 func newEmptyGrid(w, h int) *Grid {
-	cells := make([][]bool, h, h)
-	for y := range cells {
-		cells[y] = make([]bool, w, w)
-	}
-	return &Grid{Cells: cells, H: h, W: w}
+	return &Grid{W: w, H: h, cells: newBitset(w * h)}
 }
 
 func (g *Grid) IsOOB(x, y int) bool {
@@ -65,30 +68,90 @@ func (g *Grid) IsSet(x, y int) bool {
 	return !g.IsOOB(x, y) && g.Get(x, y)
 }
 
-// get value.  panics if oob
+// get value.  panics with an *OOBError if oob
 func (g *Grid) Get(x, y int) bool {
+	v, err := g.Lookup(x, y)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// like Get, but returns an *OOBError instead of panicking
+func (g *Grid) Lookup(x, y int) (bool, error) {
 	if g.IsOOB(x, y) {
-		panic(fmt.Sprintf("Grid.Get(%d, %d) is oob: Grid(w=%d, h=%d)", x, y, g.W, g.H))
+		return false, &OOBError{Op: "Get", X: x, Y: y, W: g.W, H: g.H}
 	}
-	return g.Cells[y][x]
+	return g.cells.get(y*g.W + x), nil
 }
 
+// set value.  panics with an *OOBError if oob
 func (g *Grid) Set(x, y int, b bool) {
+	if err := g.Store(x, y, b); err != nil {
+		panic(err)
+	}
+}
+
+// like Set, but returns an *OOBError instead of panicking
+func (g *Grid) Store(x, y int, b bool) error {
 	if g.IsOOB(x, y) {
-		panic(fmt.Sprintf("Grid.Set(%d, %d) is oob: Grid(w=%d, h=%d)", x, y, g.W, g.H))
+		return &OOBError{Op: "Set", X: x, Y: y, W: g.W, H: g.H}
 	}
-	g.Cells[y][x] = b
+	g.cells.set(y*g.W+x, b)
+	return nil
 }
 
 func (g *Grid) IsEmpty() bool {
-	for y := range g.Cells {
-		for x := range g.Cells[y] {
-			if g.Cells[y][x] {
-				return false
-			}
-		}
+	return g.cells.empty()
+}
+
+// the number of cells that are set
+func (g *Grid) Count() int {
+	return g.cells.count()
+}
+
+// Indexes of the cells that are set, y*W + x for the cell at (x, y), in order
+func (g *Grid) Indexes() []int {
+	return g.cells.indexes()
+}
+
+// Cells returns a copy of the cells as rows, indexed [y][x].  changing it
+// doesn't change the grid
+func (g *Grid) Cells() [][]bool {
+	cells := make([][]bool, g.H)
+	for y := range cells {
+		cells[y] = g.Row(y)
+	}
+	return cells
+}
+
+// returns a grid with the cells set in either grid, which are the same size.
+// panics if they aren't
+func (g *Grid) Union(o *Grid) *Grid {
+	g.sameSize("Union", o)
+	return &Grid{W: g.W, H: g.H, cells: g.cells.union(o.cells)}
+}
+
+// returns a grid with the cells set in both grids, which are the same size.
+// panics if they aren't
+func (g *Grid) Intersect(o *Grid) *Grid {
+	g.sameSize("Intersect", o)
+	return &Grid{W: g.W, H: g.H, cells: g.cells.intersect(o.cells)}
+}
+
+// returns a grid with the cells set in g but not in o, which are the same size.
+// panics if they aren't
+func (g *Grid) Minus(o *Grid) *Grid {
+	g.sameSize("Minus", o)
+	return &Grid{W: g.W, H: g.H, cells: g.cells.minus(o.cells)}
+}
+
+// panics if the grids aren't the same size.  like an oob Get, that's a bug
+// in the caller rather than bad input, so it isn't returned as an error
+func (g *Grid) sameSize(op string, o *Grid) {
+	if g.W != o.W || g.H != o.H {
+		panic(fmt.Sprintf("%s: grid(w=%d, h=%d) isn't the size of grid(w=%d, h=%d)", op, o.W, o.H, g.W, g.H))
 	}
-	return true
 }
 
 // Sets the values to the given subgrid values if and only if the subgrid
@@ -124,21 +187,37 @@ func (g *Grid) GetSubgrid(x, y, w, h int) *Grid {
 
 // returns a grid that's rotated 90 degrees clockwise
 func (g *Grid) Rotate() *Grid {
-	var cells [][]bool
-	for x := 0; x < g.W; x++ {
-		// x is the new y
-		row := make([]bool, g.H, g.H)
-		for y := 0; y < g.H; y++ {
-			// y is x from right to left
-			row[g.H-y-1] = g.Cells[y][x]
+	grid := newEmptyGrid(g.H, g.W)
+	for y := 0; y < g.H; y++ {
+		for x := 0; x < g.W; x++ {
+			// x is the new y, and y is the new x from right to left
+			grid.Set(g.H-y-1, x, g.Get(x, y))
 		}
-		cells = append(cells, row)
 	}
-	return &Grid{
-		Cells: cells,
-		W:     g.H,
-		H:     g.W,
+	return grid
+}
+
+// returns a grid that's mirrored left to right
+func (g *Grid) Flip() *Grid {
+	grid := newEmptyGrid(g.W, g.H)
+	for y := 0; y < g.H; y++ {
+		for x := 0; x < g.W; x++ {
+			grid.Set(g.W-x-1, y, g.Get(x, y))
+		}
 	}
+	return grid
+}
+
+func (g *Grid) Equals(o *Grid) bool {
+	return g.W == o.W && g.H == o.H && g.cells.equals(o.cells)
+}
+
+// a key for the cells of the grid, like Grid3D.key
+func (g *Grid) key() string {
+	key := make([]byte, 0, 4+8*len(g.cells))
+	key = binary.AppendUvarint(key, uint64(g.W))
+	key = binary.AppendUvarint(key, uint64(g.H))
+	return string(g.cells.appendKey(key))
 }
 
 func (g *Grid) Row(y int) []bool {
@@ -169,10 +248,10 @@ func (g *Grid) IsColEmpty(x int) bool {
 
 func (g *Grid) String() string {
 	var s bytes.Buffer
-	for y := range g.Cells {
-		for x := range g.Cells[y] {
+	for y := 0; y < g.H; y++ {
+		for x := 0; x < g.W; x++ {
 			r := '.'
-			if g.Cells[y][x] {
+			if g.Get(x, y) {
 				r = '█'
 			}
 			s.WriteRune(r)
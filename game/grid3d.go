@@ -2,28 +2,22 @@ package game
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 )
 
 type Grid3D struct {
-	Cells   [][][]bool // z, y, x
 	W, H, D int
+	cells   bitset // the cell at (x, y, z) is bit (z*H + y)*W + x
 }
 
 // returns grid set to false
 func newEmptyGrid3D(w, h, d int) *Grid3D {
-	cells := make([][][]bool, d, d)
-	for z := range cells {
-		cells[z] = make([][]bool, h, h)
-		for y := range cells[z] {
-			cells[z][y] = make([]bool, w, w)
-		}
-	}
-	return &Grid3D{Cells: cells, H: h, W: w, D: d}
+	return &Grid3D{W: w, H: h, D: d, cells: newBitset(w * h * d)}
 }
 
 func (g *Grid3D) IsOOB(x, y, z int) bool {
-	if x < 0 || y < 0 || z < 0 || x >= g.W || y >= g.H || z > g.D {
+	if x < 0 || y < 0 || z < 0 || x >= g.W || y >= g.H || z >= g.D {
 		return true
 	}
 	return false
@@ -34,48 +28,110 @@ func (g *Grid3D) IsSet(x, y, z int) bool {
 	return !g.IsOOB(x, y, z) && g.Get(x, y, z)
 }
 
-// get value.  panics if oob
+// get value.  panics with an *OOBError if oob
 func (g *Grid3D) Get(x, y, z int) bool {
+	v, err := g.Lookup(x, y, z)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// like Get, but returns an *OOBError instead of panicking
+func (g *Grid3D) Lookup(x, y, z int) (bool, error) {
 	if g.IsOOB(x, y, z) {
-		panic(fmt.Sprintf("Grid.Get(%d, %d, %d) is oob: Grid(w=%d, h=%d, d=%d)", x, y, z, g.W, g.H, g.D))
+		return false, &OOBError{Op: "Get", X: x, Y: y, Z: z, W: g.W, H: g.H, D: g.D}
 	}
-	return g.Cells[z][y][x]
+	return g.cells.get((z*g.H+y)*g.W + x), nil
 }
 
+// set value.  panics with an *OOBError if oob
 func (g *Grid3D) Set(x, y, z int, b bool) {
+	if err := g.Store(x, y, z, b); err != nil {
+		panic(err)
+	}
+}
+
+// like Set, but returns an *OOBError instead of panicking
+func (g *Grid3D) Store(x, y, z int, b bool) error {
 	if g.IsOOB(x, y, z) {
-		panic(fmt.Sprintf("Grid.Set(%d, %d, %d) is oob: Grid(w=%d, h=%d, d=%d)", x, y, z, g.W, g.H, g.D))
+		return &OOBError{Op: "Set", X: x, Y: y, Z: z, W: g.W, H: g.H, D: g.D}
 	}
-	g.Cells[z][y][x] = b
+	g.cells.set((z*g.H+y)*g.W+x, b)
+	return nil
 }
 
 func (g *Grid3D) IsEmpty() bool {
-	for z := range g.Cells {
-		for y := range g.Cells[z] {
-			for x := range g.Cells[z][y] {
-				if g.Cells[z][y][x] {
-					return false
-				}
+	return g.cells.empty()
+}
+
+// the number of cells that are set
+func (g *Grid3D) Count() int {
+	return g.cells.count()
+}
+
+// Indexes of the cells that are set, (z*H + y)*W + x for the cell at
+// (x, y, z), in order
+func (g *Grid3D) Indexes() []int {
+	return g.cells.indexes()
+}
+
+// Cells returns a copy of the cells as layers of rows, indexed [z][y][x].
+// changing it doesn't change the grid
+func (g *Grid3D) Cells() [][][]bool {
+	cells := make([][][]bool, g.D)
+	for z := range cells {
+		cells[z] = make([][]bool, g.H)
+		for y := range cells[z] {
+			cells[z][y] = make([]bool, g.W)
+			for x := range cells[z][y] {
+				cells[z][y][x] = g.IsSet(x, y, z)
 			}
 		}
 	}
-	return true
+	return cells
 }
 
-func (g *Grid3D) Equals(o *Grid3D) bool {
+// returns a grid with the cells set in either grid, which are the same size.
+// panics if they aren't
+func (g *Grid3D) Union(o *Grid3D) *Grid3D {
+	g.sameSize("Union", o)
+	return &Grid3D{W: g.W, H: g.H, D: g.D, cells: g.cells.union(o.cells)}
+}
+
+// returns a grid with the cells set in both grids, which are the same size.
+// panics if they aren't
+func (g *Grid3D) Intersect(o *Grid3D) *Grid3D {
+	g.sameSize("Intersect", o)
+	return &Grid3D{W: g.W, H: g.H, D: g.D, cells: g.cells.intersect(o.cells)}
+}
+
+// returns a grid with the cells set in g but not in o, which are the same size.
+// panics if they aren't
+func (g *Grid3D) Minus(o *Grid3D) *Grid3D {
+	g.sameSize("Minus", o)
+	return &Grid3D{W: g.W, H: g.H, D: g.D, cells: g.cells.minus(o.cells)}
+}
+
+// panics if the grids aren't the same size, like Grid.sameSize
+func (g *Grid3D) sameSize(op string, o *Grid3D) {
 	if g.W != o.W || g.H != o.H || g.D != o.D {
-		return false
+		panic(fmt.Sprintf("%s: grid(w=%d, h=%d, d=%d) isn't the size of grid(w=%d, h=%d, d=%d)", op, o.W, o.H, o.D, g.W, g.H, g.D))
 	}
-	for x := 0; x < g.W; x++ {
-		for y := 0; y < g.H; y++ {
-			for z := 0; z < g.D; z++ {
-				if g.Get(x, y, z) != o.Get(x, y, z) {
-					return false
-				}
-			}
-		}
-	}
-	return true
+}
+
+func (g *Grid3D) Equals(o *Grid3D) bool {
+	return g.W == o.W && g.H == o.H && g.D == o.D && g.cells.equals(o.cells)
+}
+
+// a key for the cells of the grid, the same for grids that are Equals, to
+// find equal grids in a map.  it's the size then the words of the cells
+func (g *Grid3D) key() string {
+	key := make([]byte, 0, 6+8*len(g.cells))
+	key = binary.AppendUvarint(key, uint64(g.W))
+	key = binary.AppendUvarint(key, uint64(g.H))
+	key = binary.AppendUvarint(key, uint64(g.D))
+	return string(g.cells.appendKey(key))
 }
 
 // Sets the values to the given subgrid values if and only if the subgrid
@@ -115,6 +171,96 @@ func (g *Grid3D) GetSubgrid(x, y, z, w, h, d int) *Grid3D {
 	return grid
 }
 
+// returns a grid stacking the layers from front to back in z.  the layers
+// have to be the same size
+func newGrid3D(layers []*Grid) *Grid3D {
+	grid := newEmptyGrid3D(layers[0].W, layers[0].H, len(layers))
+	for z, layer := range layers {
+		grid.SetPlaneZ(z, layer)
+	}
+	return grid
+}
+
+// returns a grid that's rotated 90 degrees clockwise about the z axis, so
+// each layer is turned like Grid.Rotate
+func (g *Grid3D) RotateZ() *Grid3D {
+	grid := newEmptyGrid3D(g.H, g.W, g.D)
+	for z := 0; z < g.D; z++ {
+		for y := 0; y < g.H; y++ {
+			for x := 0; x < g.W; x++ {
+				grid.Set(g.H-y-1, x, z, g.Get(x, y, z))
+			}
+		}
+	}
+	return grid
+}
+
+// returns a grid that's rotated 90 degrees about the x axis, so the top
+// row goes to the front layer
+func (g *Grid3D) RotateX() *Grid3D {
+	grid := newEmptyGrid3D(g.W, g.D, g.H)
+	for z := 0; z < g.D; z++ {
+		for y := 0; y < g.H; y++ {
+			for x := 0; x < g.W; x++ {
+				grid.Set(x, g.D-z-1, y, g.Get(x, y, z))
+			}
+		}
+	}
+	return grid
+}
+
+// returns a grid that's mirrored left to right
+func (g *Grid3D) Flip() *Grid3D {
+	grid := newEmptyGrid3D(g.W, g.H, g.D)
+	for z := 0; z < g.D; z++ {
+		for y := 0; y < g.H; y++ {
+			for x := 0; x < g.W; x++ {
+				grid.Set(g.W-x-1, y, z, g.Get(x, y, z))
+			}
+		}
+	}
+	return grid
+}
+
+// the layer and row of a cell that can't be reached from the first cell
+// through the cells next to each other, or -1, -1 if they're all connected
+func (g *Grid3D) disconnected() (int, int) {
+	seen := newEmptyGrid3D(g.W, g.H, g.D)
+	var stack [][3]int
+	for z := 0; z < g.D && stack == nil; z++ {
+		for y := 0; y < g.H && stack == nil; y++ {
+			for x := 0; x < g.W; x++ {
+				if g.Get(x, y, z) {
+					stack = append(stack, [3]int{x, y, z})
+					seen.Set(x, y, z, true)
+					break
+				}
+			}
+		}
+	}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, d := range [][3]int{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+			x, y, z := p[0]+d[0], p[1]+d[1], p[2]+d[2]
+			if g.IsSet(x, y, z) && !seen.Get(x, y, z) {
+				seen.Set(x, y, z, true)
+				stack = append(stack, [3]int{x, y, z})
+			}
+		}
+	}
+	for z := 0; z < g.D; z++ {
+		for y := 0; y < g.H; y++ {
+			for x := 0; x < g.W; x++ {
+				if g.Get(x, y, z) && !seen.Get(x, y, z) {
+					return z, y
+				}
+			}
+		}
+	}
+	return -1, -1
+}
+
 func (g *Grid3D) IsPlaneEmptyX(x int) bool {
 	for y := 0; y < g.H; y++ {
 		for z := 0; z < g.D; z++ {
@@ -181,13 +327,24 @@ func (g *Grid3D) SetPlaneZ(z int, grid *Grid) {
 	}
 }
 
+// returns the layer of the grid at z
+func (g *Grid3D) GetPlaneZ(z int) *Grid {
+	grid := newEmptyGrid(g.W, g.H)
+	for j := 0; j < g.H; j++ {
+		for i := 0; i < g.W; i++ {
+			grid.Set(i, j, g.Get(i, j, z))
+		}
+	}
+	return grid
+}
+
 func (g *Grid3D) String() string {
 	var s bytes.Buffer
-	for z := range g.Cells {
-		for y := range g.Cells[z] {
-			for x := range g.Cells[z][y] {
+	for z := 0; z < g.D; z++ {
+		for y := 0; y < g.H; y++ {
+			for x := 0; x < g.W; x++ {
 				r := '.'
-				if g.Cells[z][y][x] {
+				if g.Get(x, y, z) {
 					r = '█'
 				}
 				s.WriteRune(r)
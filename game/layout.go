@@ -0,0 +1,161 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Layout is a board partly laid out already, to see if it can be finished.
+// It's read from a layout file with a row of characters for each row of the
+// board: a . for a cell that's open, a █ for a cell that's blocked, and
+// the name of a piece for each cell of a piece that's fixed where it is.
+// Copies of a piece can be laid out next to each other, and are told apart by
+// splitting their cells into positions of the piece
+type Layout struct {
+	W, H  int
+	file  string
+	rows  [][]rune
+	lines []int // the line of each row
+}
+
+// ParseLayout parses a layout file.  Blank lines are skipped, and # starts a
+// comment.  A bad line is returned as a *ParseError
+func ParseLayout(r io.Reader) (*Layout, error) {
+	l := &Layout{}
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		fields := strings.Fields(stripComment(s.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		row := []rune(strings.Join(fields, ""))
+		if len(l.rows) > 0 && len(row) != l.W {
+			return nil, &ParseError{Line: n, Reason: fmt.Sprintf("row of the layout is %d wide, not %d like the first", len(row), l.W)}
+		}
+		l.W = len(row)
+		l.rows = append(l.rows, row)
+		l.lines = append(l.lines, n)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(l.rows) == 0 {
+		return nil, &ParseError{Line: n, Reason: "the layout has no rows"}
+	}
+	l.H = len(l.rows)
+	return l, nil
+}
+
+// LoadLayout parses a layout from a file.  a *ParseError has the name of the file
+func LoadLayout(fileName string) (*Layout, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	l, err := ParseLayout(bytes.NewReader(b))
+	if perr, ok := err.(*ParseError); ok {
+		perr.File = fileName
+	}
+	if l != nil {
+		l.file = fileName
+	}
+	return l, err
+}
+
+func (l *Layout) open(x, y int) bool {
+	return l.rows[y][x] == '.'
+}
+
+func (l *Layout) blocked(x, y int) bool {
+	return l.rows[y][x] == '█'
+}
+
+// the plays of the pieces fixed in the layout, each of which has to be a
+// position of a flat piece in the library, or it's an *UnknownPieceError or
+// a *ParseError.  the cells with the name of a piece that are next to each
+// other are split into plays of the piece
+func (l *Layout) plays(lib *Library) ([]*Play, error) {
+	var plays []*Play
+	seen := newEmptyGrid(l.W, l.H)
+	for y := 0; y < l.H; y++ {
+		for x := 0; x < l.W; x++ {
+			if l.open(x, y) || l.blocked(x, y) || seen.Get(x, y) {
+				continue
+			}
+			name := l.rows[y][x]
+			piece := lib.Piece(string(name))
+			if piece == nil {
+				return nil, &UnknownPieceError{Name: string(name)}
+			}
+			region := l.fill(x, y, seen)
+			var grids []*Grid
+			if piece.Flat() {
+				var inside []*Grid
+				for _, position := range piece.Positions(l.W, l.H) {
+					if position.Minus(region).IsEmpty() {
+						inside = append(inside, position)
+					}
+				}
+				grids = split(region, inside)
+			}
+			if grids == nil {
+				return nil, &ParseError{File: l.file, Line: l.lines[y], Reason: fmt.Sprintf("the cells of piece %c aren't positions of the piece", name)}
+			}
+			for _, grid := range grids {
+				play := &Play{Piece: piece, Fixed: true}
+				play.X, play.Y, play.Grid = trim(grid)
+				plays = append(plays, play)
+			}
+		}
+	}
+	return plays, nil
+}
+
+// the cells with the same name as the one at (x, y) that are next to it,
+// marking them seen
+func (l *Layout) fill(x, y int, seen *Grid) *Grid {
+	grid := newEmptyGrid(l.W, l.H)
+	name := l.rows[y][x]
+	stack := [][2]int{{x, y}}
+	seen.Set(x, y, true)
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		grid.Set(p[0], p[1], true)
+		for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			x, y := p[0]+d[0], p[1]+d[1]
+			if !seen.IsOOB(x, y) && l.rows[y][x] == name && !seen.Get(x, y) {
+				seen.Set(x, y, true)
+				stack = append(stack, [2]int{x, y})
+			}
+		}
+	}
+	return grid
+}
+
+// splits the region into some of the positions, each cell in one of them, or
+// returns nil if it can't.  a region that splits more than one way has the
+// same cells either way, so the first split found will do
+func split(region *Grid, positions []*Grid) []*Grid {
+	if region.IsEmpty() {
+		return []*Grid{}
+	}
+	// the first cell left has to be in one of the positions
+	first := region.Indexes()[0]
+	x, y := first%region.W, first/region.W
+	for _, position := range positions {
+		if !position.IsSet(x, y) || !position.Minus(region).IsEmpty() {
+			continue
+		}
+		if rest := split(region.Minus(position), positions); rest != nil {
+			return append([]*Grid{position}, rest...)
+		}
+	}
+	return nil
+}
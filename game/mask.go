@@ -0,0 +1,53 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// ParseMask parses a mask file, which draws the cells of a board or a cube
+// like the shape of a piece in a piece file: rows of a █ for each cell
+// and a . for a gap, with a line of dashes like --- between the layers of a
+// cube.  The cells don't have to be connected, so a board can have holes or
+// be in pieces.  A mask with one layer is for a board.
+// Blank lines are skipped, and # starts a comment.  A bad line is returned
+// as a *ParseError
+func ParseMask(r io.Reader) (*Grid3D, error) {
+	d := newDrawing("the mask")
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		fields := strings.Fields(stripComment(s.Text()))
+		if len(fields) == 0 {
+			continue
+		}
+		if err := d.add(strings.Join(fields, ""), n); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	layers, err := d.layers(n)
+	if err != nil {
+		return nil, err
+	}
+	return newGrid3D(layers), nil
+}
+
+// LoadMask parses a mask from a file.  a *ParseError has the name of the file
+func LoadMask(fileName string) (*Grid3D, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	mask, err := ParseMask(bytes.NewReader(b))
+	if perr, ok := err.(*ParseError); ok {
+		perr.File = fileName
+	}
+	return mask, err
+}
@@ -0,0 +1,289 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParsePieces parses the pieces of a piece file.
+//
+// A piece definition starts with "piece x", where x is the single character
+// name of the piece, followed by the rows of a grid drawing the piece with a
+// █ for each of its cells and a . for a gap.  A solid piece is drawn a
+// layer at a time from front to back, with a line of dashes like --- between
+// the layers.  The layers have to be rectangles of the same size, and the
+// cells have to be connected.
+// The orientations of the piece are its distinct rotations and reflections,
+// or only its rotations with "sides 1" for a piece that can't be flipped
+// over, or if chiral isn't set.  A solid piece can't be turned into its
+// mirror image, so it's "sides 1" unless given "sides 2".  "rotate n" is
+// optional for a flat piece, and if given has to be the number of distinct
+// rotations.  The color is given with "color c", where c is a hex RGB value
+// like FF0000 or #FF0000, or a name like red.
+// Defining a piece again has to draw one of the orientations of the first
+// definition, and is otherwise ignored.
+// Blank lines are skipped, and # starts a comment that runs to the end of
+// the line, unless it starts the value of a color.  A bad line is returned as a *ParseError
+func ParsePieces(r io.Reader, chiral bool) (map[string]*Piece, error) {
+	defs, err := lexPieces(r)
+	if err != nil {
+		return nil, err
+	}
+	pieces := make(map[string]*Piece)
+	lines := make(map[string]int) // the line each piece was first defined on
+	for _, def := range defs {
+		layers, err := def.layers(def.line)
+		if err != nil {
+			return nil, err
+		}
+		grid := newGrid3D(layers)
+		if z, y := grid.disconnected(); z >= 0 {
+			return nil, &ParseError{Line: def.lines[def.breaks[z]+y], Reason: fmt.Sprintf("piece %s isn't connected", def.name)}
+		}
+		if piece, ok := pieces[def.name]; ok {
+			if !hasShape3D(orientations3D(piece.Shape3D, true), grid) {
+				return nil, &ParseError{Line: def.line, Reason: fmt.Sprintf("piece %s isn't a rotation or reflection of piece %s on line %d", def.name, def.name, lines[def.name])}
+			}
+			continue
+		}
+		piece := &Piece{
+			Name:    def.name,
+			Shape3D: grid,
+			Color:   def.color,
+		}
+		if len(layers) == 1 {
+			piece.Shape = layers[0]
+		}
+		if line, ok := def.seen["rotate"]; ok {
+			if !piece.Flat() {
+				return nil, &ParseError{Line: line, Reason: fmt.Sprintf("piece %s isn't flat, so it can't have a rotate", def.name)}
+			}
+			if n := len(rotations(piece.Shape)); n != def.rotate && !(n == 1 && def.rotate == 0) {
+				return nil, &ParseError{Line: line, Reason: fmt.Sprintf("piece %s has %d rotations, not %d", def.name, n, def.rotate)}
+			}
+		}
+		piece.OneSided = def.sides == 1 || def.sides == 0 && !piece.Flat()
+		flip := chiral && !piece.OneSided
+		if piece.Flat() {
+			piece.Shapes = orientations(piece.Shape, flip)
+		}
+		piece.Shapes3D = orientations3D(grid, flip)
+		pieces[def.name] = piece
+		lines[def.name] = def.line
+	}
+	return pieces, nil
+}
+
+// a piece definition as written in a piece file
+type pieceDef struct {
+	drawing
+	line   int // the line of "piece x"
+	name   string
+	rotate int
+	sides  int // 0 if not given
+	color  []uint8
+	seen   map[string]int // the line each keyword was on
+}
+
+// the rows of a shape drawn in a file, in layers split by lines of dashes
+type drawing struct {
+	what   string // what's drawn, for errors
+	rows   []string
+	lines  []int // the line of each row
+	breaks []int // the row each layer starts at
+}
+
+func newDrawing(what string) drawing {
+	return drawing{what: what, breaks: []int{0}}
+}
+
+// adds the row on line n, or starts a new layer if it's a line of dashes
+func (d *drawing) add(row string, n int) error {
+	if strings.Trim(row, "-") == "" {
+		// a new layer, unless the last one is still empty
+		if last := d.breaks[len(d.breaks)-1]; len(d.rows) > last {
+			d.breaks = append(d.breaks, len(d.rows))
+		}
+		return nil
+	}
+	if i := strings.IndexFunc(row, func(c rune) bool { return c != '█' && c != '.' }); i >= 0 {
+		return &ParseError{Line: n, Reason: fmt.Sprintf("unexpected %q in the shape of %s", []rune(row[i:])[0], d.what)}
+	}
+	d.rows = append(d.rows, row)
+	d.lines = append(d.lines, n)
+	return nil
+}
+
+// splits a piece file into piece definitions
+func lexPieces(r io.Reader) ([]*pieceDef, error) {
+	var (
+		defs []*pieceDef
+		def  *pieceDef
+	)
+	s := bufio.NewScanner(r)
+	n := 0
+	for s.Scan() {
+		n++
+		fields := pieceFields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		keyword := fields[0]
+		switch keyword {
+		case "piece", "rotate", "sides", "color":
+		default:
+			if def == nil {
+				return nil, &ParseError{Line: n, Reason: "shape before the first piece"}
+			}
+			if err := def.add(strings.Join(fields, ""), n); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, &ParseError{Line: n, Reason: fmt.Sprintf("expected \"%s\" and one value", keyword)}
+		}
+		value := fields[1]
+		if keyword == "piece" {
+			if len([]rune(value)) != 1 {
+				return nil, &ParseError{Line: n, Reason: fmt.Sprintf("piece name %q isn't one character", value)}
+			}
+			def = &pieceDef{drawing: newDrawing("piece " + value), line: n, name: value, color: make([]uint8, 3), seen: make(map[string]int)}
+			defs = append(defs, def)
+			continue
+		}
+		if def == nil {
+			return nil, &ParseError{Line: n, Reason: fmt.Sprintf("%s before the first piece", keyword)}
+		}
+		if len(def.rows) > 0 {
+			return nil, &ParseError{Line: n, Reason: fmt.Sprintf("%s after the shape of piece %s", keyword, def.name)}
+		}
+		if line, ok := def.seen[keyword]; ok {
+			return nil, &ParseError{Line: n, Reason: fmt.Sprintf("%s of piece %s already given on line %d", keyword, def.name, line)}
+		}
+		def.seen[keyword] = n
+		var err error
+		switch keyword {
+		case "rotate":
+			def.rotate, err = strconv.Atoi(value)
+			if err == nil && def.rotate < 0 {
+				err = fmt.Errorf("can't be negative")
+			}
+		case "sides":
+			def.sides, err = strconv.Atoi(value)
+			if err == nil && def.sides != 1 && def.sides != 2 {
+				err = fmt.Errorf("has to be 1 or 2")
+			}
+		default:
+			def.color, err = parseColor(value)
+		}
+		if err != nil {
+			return nil, &ParseError{Line: n, Reason: fmt.Sprintf("bad %s %s: %s", keyword, value, err)}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// the line without its comment, from # to the end
+func stripComment(line string) string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// the fields of a line of a piece file without its comment.  the # of a color
+// like #FF0000 is part of the value, so the comment starts after it
+func pieceFields(line string) []string {
+	if f := strings.Fields(line); len(f) > 1 && f[0] == "color" && strings.HasPrefix(f[1], "#") {
+		i := strings.Index(line, "#") + 1
+		return strings.Fields(line[:i] + stripComment(line[i:]))
+	}
+	return strings.Fields(stripComment(line))
+}
+
+// the layers of the shape, which have to be rectangles of the same size with
+// some cells.  line is where the drawing starts, for errors
+func (d *drawing) layers(line int) ([]*Grid, error) {
+	if len(d.rows) == 0 {
+		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("%s has no shape", d.what)}
+	}
+	breaks := d.breaks
+	if breaks[len(breaks)-1] == len(d.rows) {
+		// a line of dashes after the last layer
+		breaks = breaks[:len(breaks)-1]
+	}
+	w := len([]rune(d.rows[0]))
+	for i, row := range d.rows {
+		if len([]rune(row)) != w {
+			return nil, &ParseError{Line: d.lines[i], Reason: fmt.Sprintf("row of %s is %d wide, not %d like the first", d.what, len([]rune(row)), w)}
+		}
+	}
+	var layers []*Grid
+	empty := true
+	for z, start := range breaks {
+		end := len(d.rows)
+		if z+1 < len(breaks) {
+			end = breaks[z+1]
+		}
+		if h := end - start; z > 0 && h != breaks[1] {
+			return nil, &ParseError{Line: d.lines[start], Reason: fmt.Sprintf("layer of %s is %d tall, not %d like the first", d.what, h, breaks[1])}
+		}
+		layer, err := newGrid(strings.Join(d.rows[start:end], "\n"))
+		if err != nil {
+			return nil, &ParseError{Line: d.lines[start], Reason: err.Error()}
+		}
+		empty = empty && layer.IsEmpty()
+		layers = append(layers, layer)
+	}
+	if empty {
+		return nil, &ParseError{Line: line, Reason: fmt.Sprintf("%s has no cells", d.what)}
+	}
+	return layers, nil
+}
+
+// named colors for the color of a piece
+var colorNames = map[string]string{
+	"black":  "000000",
+	"white":  "FFFFFF",
+	"gray":   "9E9E9E",
+	"red":    "D32F2F",
+	"pink":   "E91E63",
+	"purple": "8E24AA",
+	"indigo": "3F51B5",
+	"blue":   "1976D2",
+	"cyan":   "00BCD4",
+	"teal":   "4DB6AC",
+	"green":  "388E3C",
+	"lime":   "CDDC39",
+	"yellow": "FFD600",
+	"amber":  "FFC107",
+	"orange": "F57C00",
+	"brown":  "5D4037",
+}
+
+// parses RRGGBB, #RRGGBB or a color name
+func parseColor(s string) ([]uint8, error) {
+	if hex, ok := colorNames[strings.ToLower(s)]; ok {
+		s = hex
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return nil, fmt.Errorf("expected RRGGBB, #RRGGBB or a color name")
+	}
+	color := make([]uint8, 3)
+	for i := range color {
+		n, err := strconv.ParseUint(s[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("expected RRGGBB, #RRGGBB or a color name")
+		}
+		color[i] = uint8(n)
+	}
+	return color, nil
+}
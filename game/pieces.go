@@ -1,132 +1,263 @@
 package game
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"strconv"
-	"strings"
+	"unicode"
 )
 
-// Game piece.  Instead of generating all symmetries programmatically,
-// we note all pieces are 2D and in a 2D game, pices are either symmetric or
-// have a chirality.  Then, to generate all positional permutations, the only
-// other thing we need are the rotational symmetries.  Furthermore, in a 3D
-// game with 2D pieces, the same symmetries hold along each dimension.
+// Game piece.  A piece is drawn once in the piece file, and its orientations
+// are generated by rotating it and, unless it's one sided, flipping it over,
+// keeping only the distinct ones.  A flat piece has orientations in the plane
+// of a board, and every piece has orientations in a cube, which are the
+// distinct ones of the 24 rotations of a cube and, if it has two sides, of
+// its mirror image.
 type Piece struct {
-	Name   string
-	Shapes []*Grid // one shape if symmetrical, two if chiral
-	Rotate int     // # of rotation symmetries
-	Color  []uint8
+	Name     string
+	Shape    *Grid     // as drawn in the piece file, or nil if it isn't flat
+	Shapes   []*Grid   // the distinct orientations of the shape
+	Shape3D  *Grid3D   // as drawn in the piece file, a layer for each z
+	Shapes3D []*Grid3D // the distinct orientations of the shape in a cube
+	OneSided bool      // can't be flipped over, or turned into its mirror image
+	Color    []uint8
 }
 
 func (p *Piece) String() string {
 	var s bytes.Buffer
-	s.WriteString(fmt.Sprintf("piece %s:\n", p.Name))
-	for i, shape := range p.Shapes {
-		s.WriteString(fmt.Sprintf("%d:\n", i))
-		s.WriteString(shape.String())
+	if p.Flat() {
+		s.WriteString(fmt.Sprintf("piece %s: %d orientations, %d in a cube\n", p.Name, len(p.Shapes), len(p.Shapes3D)))
+		s.WriteString(p.Shape.String())
+	} else {
+		s.WriteString(fmt.Sprintf("piece %s: %d orientations in a cube\n", p.Name, len(p.Shapes3D)))
+		s.WriteString(p.Shape3D.String())
 	}
 	return s.String()
 }
 
-// parses pieces from a piece spec
-// a piece definition starts with "piece x" where x is the single character name of the piece
-// followed by a single grid representing the piece.
-// rotation symmetries are specified with "rotate n".  default is 0 (no rotation symmetries)
-// color is specified with "color c" where c is a hex RGB value like FF0000
-// chiral specifies if we're including the flip symmetries of pieces that have chirality
-func ParsePieces(r io.Reader, chiral bool) map[string]*Piece {
-	pieces := make(map[string]*Piece)
-	var lines []string
-	s := bufio.NewScanner(r)
-	for s.Scan() {
-		lines = append(lines, s.Text())
-	}
-	if s.Err() != nil {
-		panic(s.Err())
-	}
-	for i := 0; i < len(lines); i++ {
-		if !strings.HasPrefix(lines[i], "piece") {
-			continue
+// Flat is whether the piece has one layer, so it can be played on a board
+func (p *Piece) Flat() bool {
+	return p.Shape != nil
+}
+
+// the distinct quarter turns of the shape, starting with the shape itself
+func rotations(shape *Grid) []*Grid {
+	shapes := []*Grid{shape}
+	for i := 1; i < 4; i++ {
+		shape = shape.Rotate()
+		shapes = appendShape(shapes, shape)
+	}
+	return shapes
+}
+
+// the distinct orientations of the shape: its rotations, then the rotations
+// of its mirror image if it can be flipped
+func orientations(shape *Grid, flip bool) []*Grid {
+	shapes := rotations(shape)
+	if flip {
+		for _, mirror := range rotations(shape.Flip()) {
+			shapes = appendShape(shapes, mirror)
 		}
-		name := lines[i][6:7]
-		var shape bytes.Buffer
-		color := make([]uint8, 3, 3)
-		rotate := 0
-		for j := i + 1; j < len(lines) && !strings.HasPrefix(lines[j], "piece"); j++ {
-			if strings.HasPrefix(lines[j], "rotate") {
-				r, err := strconv.Atoi(lines[j][7:8])
-				if err != nil {
-					panic(fmt.Sprintf("error parsing rotate%s: %s", lines[j], err))
-				}
-				rotate = r
-				continue
-			}
-			if strings.HasPrefix(lines[j], "color") {
-				str := lines[j][6:12]
-				for i := 0; i < 3; i++ {
-					n, err := strconv.ParseUint("0x"+str[i*2:i*2+2], 0, 8)
-					if err != nil {
-						panic(fmt.Sprintf("error parsing color %s: %s", lines[j], err))
-					}
-					color[i] = uint8(n)
-				}
-				continue
-			}
-			shape.WriteString(lines[j])
-			shape.WriteRune('\n')
+	}
+	return shapes
+}
+
+// appends the shape unless it's already one of the shapes
+func appendShape(shapes []*Grid, shape *Grid) []*Grid {
+	if hasShape(shapes, shape) {
+		return shapes
+	}
+	return append(shapes, shape)
+}
+
+func hasShape(shapes []*Grid, shape *Grid) bool {
+	for _, s := range shapes {
+		if s.Equals(shape) {
+			return true
 		}
-		grid := newGrid(shape.String())
-		if piece, ok := pieces[name]; ok {
-			if chiral {
-				piece.Shapes = append(piece.Shapes, grid)
-			} // otherwise use the first piece we found
-		} else {
-			pieces[name] = &Piece{
-				Name:   name,
-				Shapes: []*Grid{grid},
-				Rotate: rotate,
-				Color:  color,
-			}
+	}
+	return false
+}
+
+// the distinct orientations of the shape in a cube: the rotations of a cube,
+// generated by quarter turns about the x and z axes, then the rotations of
+// its mirror image if it can be flipped
+func orientations3D(shape *Grid3D, flip bool) []*Grid3D {
+	shapes := rotations3D(nil, shape)
+	if flip {
+		shapes = rotations3D(shapes, shape.Flip())
+	}
+	return shapes
+}
+
+// appends the distinct rotations of the shape to the shapes
+func rotations3D(shapes []*Grid3D, shape *Grid3D) []*Grid3D {
+	i := len(shapes)
+	shapes = appendShape3D(shapes, shape)
+	for ; i < len(shapes); i++ {
+		shapes = appendShape3D(shapes, shapes[i].RotateX())
+		shapes = appendShape3D(shapes, shapes[i].RotateZ())
+	}
+	return shapes
+}
+
+func appendShape3D(shapes []*Grid3D, shape *Grid3D) []*Grid3D {
+	if hasShape3D(shapes, shape) {
+		return shapes
+	}
+	return append(shapes, shape)
+}
+
+func hasShape3D(shapes []*Grid3D, shape *Grid3D) bool {
+	for _, s := range shapes {
+		if s.Equals(shape) {
+			return true
 		}
 	}
-	return pieces
+	return false
 }
 
-var allPieces map[string]*Piece
+// Library is a set of pieces parsed from a piece file, to make games with.
+// It's read only once made, so games can be made from it concurrently
+type Library struct {
+	pieces map[string]*Piece
+	debug  DebugOptions
+}
 
-// parse pieces from a file
-func LoadPieces(fileName string, chiral bool) {
+// NewLibrary parses the pieces of a library like ParsePieces
+func NewLibrary(r io.Reader, chiral bool) (*Library, error) {
+	pieces, err := ParsePieces(r, chiral)
+	if err != nil {
+		return nil, err
+	}
+	return &Library{pieces: pieces}, nil
+}
+
+// LoadLibrary parses the pieces of a library from a file.  a *ParseError
+// has the name of the file
+func LoadLibrary(fileName string, chiral bool) (*Library, error) {
 	b, err := ioutil.ReadFile(fileName)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	lib, err := NewLibrary(bytes.NewReader(b), chiral)
+	if perr, ok := err.(*ParseError); ok {
+		perr.File = fileName
 	}
-	allPieces = ParsePieces(bytes.NewReader(b), chiral)
+	return lib, err
 }
 
-func AllPieces() []*Piece {
+// WithDebug is a copy of the library, sharing its pieces, that debugs the
+// games made with it.  debugging a piece it doesn't have is an *UnknownPieceError
+func (l *Library) WithDebug(debug DebugOptions) (*Library, error) {
+	if _, ok := l.pieces[debug.Piece]; debug.Piece != "" && !ok {
+		return nil, &UnknownPieceError{Name: debug.Piece}
+	}
+	return &Library{pieces: l.pieces, debug: debug}, nil
+}
+
+// Piece is the piece with the name, or nil if there's none
+func (l *Library) Piece(name string) *Piece {
+	return l.pieces[name]
+}
+
+// Pieces in the library
+func (l *Library) Pieces() []*Piece {
 	var pieces []*Piece
-	for _, piece := range allPieces {
+	for _, piece := range l.pieces {
 		pieces = append(pieces, piece)
 	}
 	return pieces
 }
 
+// the library LoadPieces loads, for the package level helpers
+var std = &Library{}
+
+// parse pieces from a file into the library the package level helpers use
+func LoadPieces(fileName string, chiral bool) error {
+	lib, err := LoadLibrary(fileName, chiral)
+	if err != nil {
+		return err
+	}
+	std = lib
+	return nil
+}
+
+// Default is the library loaded by LoadPieces
+func Default() *Library {
+	return std
+}
+
+func AllPieces() []*Piece {
+	return std.Pieces()
+}
+
+// bounds on how many copies of a piece are used
+type Bound struct {
+	Min, Max int
+}
+
 // gets the pieces represented by a string of consecutive one-character piece names
-func parsePiecesSpec(piecesSpec string) []*Piece {
-	if allPieces == nil {
-		panic("ensure LoadPieces(file) is called first")
+// a name can be followed by a count like o2 or a range like o1-3.  repeating
+// a name adds to its count, so ooO is the same as o2O.
+// returns the distinct pieces in order and the bounds on how many of each are used,
+// or an *UnknownPieceError or *SpecError
+func (l *Library) parsePiecesSpec(piecesSpec string) ([]*Piece, []Bound, error) {
+	if l.pieces == nil {
+		return nil, nil, errors.New("no pieces loaded")
 	}
-	var pieces []*Piece
-	for _, char := range piecesSpec {
-		if piece, ok := allPieces[string(char)]; ok {
-			pieces = append(pieces, piece)
-		} else {
-			panic(fmt.Sprintf("no piece \"%c\" defined", char))
+	if piecesSpec == "" {
+		return nil, nil, &SpecError{Spec: piecesSpec, Reason: "no pieces"}
+	}
+	var (
+		pieces []*Piece
+		bounds []Bound
+	)
+	index := make(map[*Piece]int)
+	spec := []rune(piecesSpec)
+	for i := 0; i < len(spec); i++ {
+		name := spec[i]
+		piece, ok := l.pieces[string(name)]
+		if !ok {
+			return nil, nil, &UnknownPieceError{Name: string(name)}
+		}
+		// parse an optional count or range
+		bound := Bound{1, 1}
+		if n, j := parseCount(spec, i+1); j > i+1 {
+			bound = Bound{n, n}
+			i = j - 1
+			if j < len(spec) && spec[j] == '-' {
+				m, k := parseCount(spec, j+1)
+				if k == j+1 || m < n {
+					return nil, nil, &SpecError{Spec: piecesSpec, Reason: fmt.Sprintf("bad count range for piece \"%c\"", name)}
+				}
+				bound.Max = m
+				i = k - 1
+			}
 		}
+		if bound.Max == 0 {
+			return nil, nil, &SpecError{Spec: piecesSpec, Reason: fmt.Sprintf("piece \"%c\" can't have a count of 0", name)}
+		}
+		if x, ok := index[piece]; ok {
+			bounds[x].Min += bound.Min
+			bounds[x].Max += bound.Max
+			continue
+		}
+		index[piece] = len(pieces)
+		pieces = append(pieces, piece)
+		bounds = append(bounds, bound)
 	}
-	return pieces
+	return pieces, bounds, nil
+}
+
+// parses the decimal number starting at spec[i]
+// returns the number and the index after it, which is i if there's no number
+func parseCount(spec []rune, i int) (int, int) {
+	n := 0
+	for ; i < len(spec) && unicode.IsDigit(spec[i]); i++ {
+		n = n*10 + int(spec[i]-'0')
+	}
+	return n, i
 }
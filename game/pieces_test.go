@@ -1,12 +1,22 @@
 package game
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
 )
 
+func testGrid(t *testing.T, spec string) *Grid {
+	g, err := newGrid(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
 func TestNewGrid(t *testing.T) {
-	g := newGrid(`
+	g := testGrid(t, `
 piece k
 ██
 █.
@@ -35,7 +45,7 @@ piece k
 }
 
 func TestRotateGrid(t *testing.T) {
-	g := newGrid(`
+	g := testGrid(t, `
 ██
 █.
 .█
@@ -63,75 +73,69 @@ func TestRotateGrid(t *testing.T) {
 }
 
 func TestGridNotRectangle(t *testing.T) {
-	defer func() {
-		if r := recover(); r == nil {
-			t.Errorf("The code did not panic")
-		}
-	}()
-	newGrid(`
+	_, err := newGrid(`
 ██
 .█
 █.█
 `)
+	if err == nil {
+		t.Errorf("expected an error for a grid that's not a rectangle")
+	}
 }
 
 func TestParsePieces(t *testing.T) {
 	data := `
 piece t
-rotate 9
-###
-.#.
+rotate 4
+███
+.█.
 piece n
-rotate 2
 .██.
-█..█
+████
 █..█
 piece t
-rotate 3
-...
-█.█
+.█.
+███
 `
-	pieces := ParsePieces(strings.NewReader(data))
+	pieces, err := ParsePieces(strings.NewReader(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	pt, ok := pieces["t"]
 	if !ok {
 		t.Fatal("missing t")
 	}
-	if len(pt.Shapes) != 2 {
-		t.Error("expected 2 t pieces")
-	}
-	if pt.Rotate != 9 {
-		t.Errorf("expected t to have 9 rotations, got %d", pt.Rotate)
+	if len(pt.Shapes) != 4 {
+		t.Errorf("expected 4 t orientations, got %d", len(pt.Shapes))
 	}
 
 	n, ok := pieces["n"]
 	if !ok {
 		t.Fatal("missing n")
 	}
-	if len(n.Shapes) != 1 {
-		t.Error("expected 1 n pieces")
-	}
-	if n.Rotate != 2 {
-		t.Errorf("expected n to have 2 rotations, got %d", n.Rotate)
+	if len(n.Shapes) != 4 {
+		t.Errorf("expected 4 n orientations, got %d", len(n.Shapes))
 	}
 
 	tests := []*Grid{
 		pt.Shapes[0],
 		pt.Shapes[1],
-		n.Shapes[0],
+		n.Shape,
 	}
 	expects := [][][]bool{
-		{ // first t
+		{ // t as drawn
 			{true, true, true},
 			{false, true, false},
 		},
-		{ // second t
-			{false, false, false},
-			{true, false, true},
+		{ // t turned clockwise
+			{false, true},
+			{true, true},
+			{false, true},
 		},
 		{ // n
 			{false, true, true, false},
-			{true, false, false, true},
+			{true, true, true, true},
 			{true, false, false, true},
 		},
 	}
@@ -148,20 +152,226 @@ rotate 3
 	}
 }
 
+func TestOrientations(t *testing.T) {
+	data := `
+piece L
+█.
+█.
+██
+piece s
+.██
+██.
+piece s
+██.
+.██
+piece O
+██
+██
+piece J
+sides 1
+.█
+.█
+██
+`
+	for _, c := range []struct {
+		chiral bool
+		expect map[string]int
+	}{
+		{true, map[string]int{"L": 8, "s": 4, "O": 1, "J": 4}},
+		{false, map[string]int{"L": 4, "s": 2, "O": 1, "J": 4}},
+	} {
+		pieces, err := ParsePieces(strings.NewReader(data), c.chiral)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, n := range c.expect {
+			if got := len(pieces[name].Shapes); got != n {
+				t.Errorf("expected %d orientations of %s with chiral %v, got %d", n, name, c.chiral, got)
+			}
+		}
+	}
+}
+
+func TestOrientations3D(t *testing.T) {
+	data := `
+piece L
+███
+█..
+piece A
+██
+.█
+---
+█.
+..
+piece B
+██
+█.
+---
+.█
+..
+---
+piece P
+sides 2
+██
+█.
+---
+█.
+..
+`
+	lib, err := NewLibrary(strings.NewReader(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range map[string]int{"L": 24, "A": 12, "B": 12, "P": 8} {
+		if got := len(lib.Piece(name).Shapes3D); got != n {
+			t.Errorf("expected %d orientations of %s in a cube, got %d", n, name, got)
+		}
+	}
+	a, b := lib.Piece("A"), lib.Piece("B")
+	if a.Flat() || hasShape3D(a.Shapes3D, b.Shape3D) || !hasShape3D(orientations3D(a.Shape3D, true), b.Shape3D) {
+		t.Errorf("expected A and B to be solid mirror images")
+	}
+	g := a.Shape3D
+	for i := 0; i < 4; i++ {
+		g = g.RotateX()
+		if i < 3 && !hasShape3D(a.Shapes3D, g.RotateZ()) {
+			t.Errorf("expected a rotation of A to be one of its orientations")
+		}
+	}
+	if !g.Equals(a.Shape3D) {
+		t.Errorf("expected four quarter turns to be the same shape, got\n%s", g)
+	}
+	c, err := NewCube(lib, 2, 2, 2, "P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.Coverage.Options); n != 8 {
+		t.Errorf("expected P in each corner of a 2x2x2 cube, got %d positions", n)
+	}
+	var spec *SpecError
+	if _, err := NewBoard(lib, 4, 4, "LA"); !errors.As(err, &spec) {
+		t.Errorf("expected a spec error playing a solid piece on a board, got %v", err)
+	}
+
+	// turning a flat piece over is a rotation in a cube, so a one sided piece
+	// is played as its mirror image there too
+	lib, err = NewLibrary(strings.NewReader("piece L\n███\n█..\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := lib.Piece("L")
+	if len(l.Shapes) != 4 || !hasShape3D(l.Shapes3D, newGrid3D([]*Grid{l.Shape.Flip()})) {
+		t.Errorf("expected L to be one sided on a board and flipped over in a cube")
+	}
+	if _, err := NewCube(lib, 2, 2, 3, "L"); err != nil {
+		t.Errorf("expected a one sided L to be played in a cube, got %v", err)
+	}
+}
+
+func TestPositionsUnique(t *testing.T) {
+	// a cell drawn with an empty edge has orientations that only differ by
+	// where the edge is, which make the same placements
+	lib, err := NewLibrary(strings.NewReader("piece o\n█.\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := lib.Piece("o")
+	if n := len(o.Positions(2, 2)); n != 4 {
+		t.Errorf("expected 4 positions on a 2x2 board, got %d", n)
+	}
+	if n := len(o.Positions3D(2, 2, 2)); n != 8 {
+		t.Errorf("expected 8 positions in a 2x2x2 cube, got %d", n)
+	}
+	grids := append(o.Positions3D(2, 2, 2), o.Shapes3D...)
+	for _, g := range grids {
+		for _, h := range grids {
+			if (g.key() == h.key()) != g.Equals(h) {
+				t.Fatalf("expected keys to match when grids are equal:\n%s\n%s", g, h)
+			}
+		}
+	}
+}
+
 func TestEmpty(t *testing.T) {
 	grid := newEmptyGrid(5, 3)
 	if !grid.IsEmpty() {
 		t.Fatal("expected empty grid, got non-empty")
 	}
-	grid.Cells[2][4] = true
+	grid.Set(4, 2, true)
 	if grid.IsEmpty() {
 		t.Fatal("expected non-empty grid, got empty")
 	}
 }
 
+func TestGridBits(t *testing.T) {
+	// big enough that the cells take more than one word
+	a, b := newEmptyGrid(10, 10), newEmptyGrid(10, 10)
+	a.Set(3, 6, true)
+	a.Set(9, 9, true)
+	b.Set(9, 9, true)
+	b.Set(0, 0, true)
+	b.Set(0, 0, false)
+	b.Set(4, 0, true)
+	if n := a.Union(b).Count(); n != 3 {
+		t.Errorf("expected 3 cells in the union, got %d", n)
+	}
+	if is := a.Intersect(b).Indexes(); len(is) != 1 || is[0] != 99 {
+		t.Errorf("expected the intersection to be cell 99, got %v", is)
+	}
+	if is := a.Union(b).Indexes(); len(is) != 3 || is[0] != 4 || is[1] != 63 || is[2] != 99 {
+		t.Errorf("expected cells 4, 63 and 99 in order, got %v", is)
+	}
+	c := newEmptyGrid3D(5, 5, 5)
+	c.Set(4, 2, 3, true)
+	if is := c.Indexes(); len(is) != 1 || is[0] != (3*5+2)*5+4 || !c.Union(c).Equals(c) {
+		t.Errorf("expected cell (4, 2, 3) at %d, got %v", (3*5+2)*5+4, is)
+	}
+	if !c.Intersect(newEmptyGrid3D(5, 5, 5)).IsEmpty() {
+		t.Errorf("expected an empty intersection")
+	}
+	if is := a.Minus(b).Indexes(); len(is) != 1 || is[0] != 63 {
+		t.Errorf("expected a minus b to be cell 63, got %v", is)
+	}
+	if !c.Minus(c).IsEmpty() || !c.Minus(newEmptyGrid3D(5, 5, 5)).Equals(c) {
+		t.Errorf("expected c minus itself to be empty and minus nothing to be c")
+	}
+
+	cells := a.Cells()
+	if len(cells) != 10 || len(cells[0]) != 10 || !cells[6][3] || cells[3][6] {
+		t.Errorf("expected the cells indexed [y][x], got %v", cells)
+	}
+	cells[0][0] = true
+	if a.Get(0, 0) {
+		t.Errorf("expected changing the cells to leave the grid alone")
+	}
+	if cells := c.Cells(); len(cells) != 5 || !cells[3][2][4] || cells[4][2][3] {
+		t.Errorf("expected the cells indexed [z][y][x]")
+	}
+}
+
+func TestGridSizePanics(t *testing.T) {
+	panics := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected %s of grids of different sizes to panic", name)
+			}
+		}()
+		f()
+	}
+	a, b := newEmptyGrid(2, 3), newEmptyGrid(3, 2)
+	panics("Union", func() { a.Union(b) })
+	panics("Intersect", func() { a.Intersect(b) })
+	panics("Minus", func() { a.Minus(b) })
+	c, d := newEmptyGrid3D(2, 2, 2), newEmptyGrid3D(2, 2, 3)
+	panics("Union", func() { c.Union(d) })
+	panics("Intersect", func() { c.Intersect(d) })
+	panics("Minus", func() { c.Minus(d) })
+}
+
 func TestSetSubgrid(t *testing.T) {
 	g := newEmptyGrid(5, 3)
-	piece := newGrid("███\n.█.")
+	piece := testGrid(t, "███\n.█.")
 
 	// attempt oob at various positions
 	g.SetSubgrid(100, 100, piece)
@@ -197,3 +407,325 @@ func TestSetSubgrid(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePiecesSpec(t *testing.T) {
+	lib, _ := NewLibrary(strings.NewReader(`
+piece o
+█
+piece v
+██
+█.
+`), true)
+	pieces, bounds, err := lib.parsePiecesSpec("oovo2-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pieces) != 2 || pieces[0].Name != "o" || pieces[1].Name != "v" {
+		t.Fatalf("expected pieces o and v, got %v", pieces)
+	}
+	expect := []Bound{{4, 5}, {1, 1}}
+	for i := range expect {
+		if bounds[i] != expect[i] {
+			t.Errorf("expected bounds %v for %s, got %v", expect[i], pieces[i].Name, bounds[i])
+		}
+	}
+}
+
+func TestOptionalPieces(t *testing.T) {
+	lib, err := NewLibrary(strings.NewReader("piece o\n█\npiece i\n██\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cells of a 2x1 board are covered by both o or by i, but not by all three
+	for _, optional := range []bool{false, true} {
+		b, err := NewBoard(lib, 2, 1, "o2i")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cov := b.Coverage
+		expect := 0
+		if optional {
+			cov.OptionalPieces()
+			expect = 2
+		}
+		if cov.Bounds[1] != (Bound{1, 1}) {
+			t.Errorf("expected the bounds of i to stay 1 on its secondary column, got %v", cov.Bounds[1])
+		}
+		dl := cov.Problem().DancingLinks()
+		if err := dl.Search(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if dl.N != expect {
+			t.Errorf("expected %d solutions with optional pieces %v, got %d", expect, optional, dl.N)
+		}
+	}
+}
+
+func TestLibrary(t *testing.T) {
+	// two libraries with different pieces named o, used at once
+	cells, _ := NewLibrary(strings.NewReader("piece o\n█\n"), true)
+	dominoes, _ := NewLibrary(strings.NewReader("piece o\nrotate 2\n██\n"), true)
+	dominoes, _ = dominoes.WithDebug(DebugOptions{Piece: "o"})
+	done := make(chan *Board)
+	go func() {
+		b, _ := NewBoard(cells, 2, 2, "o4")
+		done <- b
+	}()
+	b, _ := NewBoard(dominoes, 2, 2, "o2")
+	if n := len(b.Coverage.Options); n != 4 {
+		t.Errorf("expected 4 domino positions, got %d", n)
+	}
+	if n := len((<-done).Coverage.Options); n != 4 {
+		t.Errorf("expected 4 cell positions, got %d", n)
+	}
+	if cells.debug.Piece != "" {
+		t.Errorf("expected debugging a copy to leave the library alone")
+	}
+
+	// the package level helpers debug the games made after them
+	defer func(lib *Library) { std = lib }(std)
+	std = cells
+	before, _ := NewBoard(Default(), 2, 2, "o4")
+	SetDebugCoverage()
+	if before.debug.Coverage || cells.debug.Coverage || !Default().debug.Coverage {
+		t.Errorf("expected SetDebugCoverage to only debug the games made after it")
+	}
+	if err := SetDebugPiece("x"); err == nil || Default().debug.Piece != "" {
+		t.Errorf("expected debugging an unknown piece to fail and leave the options alone")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, c := range []struct {
+		data string
+		line int
+	}{
+		{"piece\n█\n", 1},
+		{"piece o\nrotate\n█\n", 2},
+		{"piece o\nrotate x\n█\n", 2},
+		{"piece o\n█\npiece v\ncolor FF\n██\n", 4},
+		{"piece o\ncolor GG0000\n█\n", 2},
+		{"piece o\n█.\n██\n█\n", 4},
+		{"piece o\n\npiece v\n█\n", 1},
+		{"piece o\n█.\n.█\n", 3},
+		{"piece o\n█\nrotate 2\n", 3},
+		{"█\npiece o\n", 1},
+		{"piece o\nrotate 2\nrotate 4\n█\n", 3},
+		{"piece o\nrotate 2\n█\n", 2},
+		{"piece o\nsides 3\n█\n", 2},
+		{"piece v\n██\n█.\npiece v\n██\n", 4},
+		{"piece v\n██\n---\n█\n", 4},
+		{"piece v\n█\n---\n█\n█\n", 4},
+		{"piece v\n█.\n---\n.█\n", 4},
+		{"piece v\nrotate 1\n█\n---\n█\n", 2},
+		{"piece o\n█x\n", 2},
+		{"piece oo\n█\n", 1},
+		{"piece o\ncolor # red\n█\n", 2},
+	} {
+		_, err := ParsePieces(strings.NewReader(c.data), true)
+		var parse *ParseError
+		if !errors.As(err, &parse) || parse.Line != c.line {
+			t.Errorf("expected a parse error on line %d of %q, got %v", c.line, c.data, err)
+		}
+	}
+
+	_, err := LoadLibrary("testdata/missing.txt", true)
+	if err == nil {
+		t.Errorf("expected an error loading a missing file")
+	}
+
+	lib, _ := NewLibrary(strings.NewReader("piece o\n█\n"), true)
+	var unknown *UnknownPieceError
+	if _, err := NewBoard(lib, 2, 2, "ox"); !errors.As(err, &unknown) || unknown.Name != "x" {
+		t.Errorf("expected an unknown piece x, got %v", err)
+	}
+	if _, err := lib.WithDebug(DebugOptions{Piece: "x"}); !errors.As(err, &unknown) {
+		t.Errorf("expected an unknown piece to debug, got %v", err)
+	}
+	var spec *SpecError
+	for _, bad := range []string{"", "o0", "o3-2", "o2-"} {
+		if _, err := NewCube(lib, 2, 2, 2, bad); !errors.As(err, &spec) {
+			t.Errorf("expected a spec error for %q, got %v", bad, err)
+		}
+	}
+
+	var oob *OOBError
+	if _, err := newEmptyGrid(2, 3).Lookup(2, 0); !errors.As(err, &oob) || oob.X != 2 {
+		t.Errorf("expected an oob error, got %v", err)
+	}
+	if err := newEmptyGrid3D(2, 2, 2).Store(0, 0, 2, true); !errors.As(err, &oob) || oob.Z != 2 {
+		t.Errorf("expected an oob error, got %v", err)
+	}
+}
+
+func TestParsePiecesFormat(t *testing.T) {
+	data := `
+# pieces with comments   
+
+piece   I    # the long one
+	rotate 2
+color    #FF9800 #
+█
+  █# a cell, then a comment
+ █
+piece L
+color teal#a named color
+█.
+██
+piece S
+. █ █
+█ █ .  # cells drawn with spaces
+piece l
+█ █ █
+`
+	pieces, err := ParsePieces(strings.NewReader(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := pieces["I"]
+	if i == nil || len(i.Shapes) != 2 || i.Shape.H != 3 || i.Shape.W != 1 {
+		t.Fatalf("misparsed I: %v", i)
+	}
+	if i.Color[0] != 0xFF || i.Color[1] != 0x98 || i.Color[2] != 0 {
+		t.Errorf("expected color FF9800, got %v", i.Color)
+	}
+	if l := pieces["L"]; l == nil || l.Color[0] != 0x4D || l.Shape.W != 2 {
+		t.Errorf("misparsed L: %v", l)
+	}
+	if s := pieces["S"]; s == nil || s.Shape.W != 3 || s.Shape.H != 2 || s.Shape.Count() != 4 {
+		t.Errorf("misparsed S drawn with spaces: %v", s)
+	}
+	if l := pieces["l"]; l == nil || l.Shape.W != 3 || l.Shape.Count() != 3 {
+		t.Errorf("misparsed l drawn with spaces: %v", l)
+	}
+}
+
+func TestMask(t *testing.T) {
+	lib, err := NewLibrary(strings.NewReader("piece v\n██\n█.\npiece o\n█\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask, err := ParseMask(strings.NewReader("# an L\n██\n█.  # with a gap\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mask.D != 1 {
+		t.Fatalf("expected a mask of one layer, got %d", mask.D)
+	}
+	b, err := NewMaskedBoard(lib, mask.GetPlaneZ(0), "v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cov := b.Coverage
+	if len(cov.Columns) != 4 || cov.Columns[3] != "c2" || len(cov.Options) != 1 {
+		t.Fatalf("expected v to fit the L once, with columns for its cells, got %v", cov)
+	}
+	if play := b.Play([]int{0})[0]; play.X != 0 || play.Y != 0 || !play.Grid.Equals(mask.GetPlaneZ(0)) {
+		t.Errorf("expected v played on the L, got %v", play)
+	}
+
+	mask, err = ParseMask(strings.NewReader("█.\n..\n---\n.█\n.█\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewMaskedCube(lib, mask, "o3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.Coverage.Options); n != 3 {
+		t.Fatalf("expected o in each of the 3 cells, got %d", n)
+	}
+	if play := c.Play([]int{2})[0]; play.X != 1 || play.Y != 1 || play.Z != 1 {
+		t.Errorf("expected o played at (1, 1, 1), got %v", play)
+	}
+
+	for _, bad := range []struct {
+		data string
+		line int
+	}{
+		{"██\n█\n", 2},
+		{"██\n---\n█.\n█.\n", 3},
+		{"..\n..\n", 2},
+		{"█x\n", 1},
+	} {
+		_, err := ParseMask(strings.NewReader(bad.data))
+		var parse *ParseError
+		if !errors.As(err, &parse) || parse.Line != bad.line {
+			t.Errorf("expected a parse error on line %d of %q, got %v", bad.line, bad.data, err)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	lib, err := NewLibrary(strings.NewReader("piece v\n██\n█.\npiece o\n█\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := ParseLayout(strings.NewReader("# v fixed with a cell blocked\nvv.\nv█.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPartialBoard(lib, layout, nil, "vo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(b.Coverage.Options); n != 2 {
+		t.Fatalf("expected o in each of the 2 open cells, got %d", n)
+	}
+	plays := b.Play([]int{0, 1})
+	if len(plays) != 3 || !plays[0].Fixed || plays[0].Piece.Name != "v" || plays[1].Fixed {
+		t.Fatalf("expected the fixed v and then both o, got %v", plays)
+	}
+	if plays[1].X != 2 || plays[1].Y != 0 || plays[2].X != 2 || plays[2].Y != 1 {
+		t.Errorf("expected o played at (2, 0) and (2, 1), got %v", plays[1:])
+	}
+
+	// copies of a piece next to each other are split into plays of the piece
+	lib2, err := NewLibrary(strings.NewReader("piece v\n██\n█.\npiece i\n██\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err = ParseLayout(strings.NewReader("vvi.\nvvi.\nvv..\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = NewPartialBoard(lib2, layout, nil, "v2i3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Fixed) != 3 || b.Fixed[0].Piece.Name != "v" || b.Fixed[1].Piece.Name != "v" || b.Fixed[2].Piece.Name != "i" {
+		t.Fatalf("expected two copies of v and one of i laid out, got %v", b.Fixed)
+	}
+	if n := b.Fixed[0].Grid.Count() + b.Fixed[1].Grid.Count(); n != 6 {
+		t.Errorf("expected the copies of v to cover its 6 cells, got %d", n)
+	}
+	if _, err := NewPartialBoard(lib2, layout, nil, "vi3"); err == nil {
+		t.Errorf("expected an error laying out two copies of v with one in the spec")
+	}
+
+	mask, err := newGrid("██\n█.\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []struct {
+		layout, spec string
+		mask         *Grid
+		err          interface{}
+	}{
+		{"vvv\n...\n", "vo3", nil, new(*ParseError)},
+		{"vvvv\n....\n", "v2o4", nil, new(*ParseError)},
+		{"x.\n..\n", "v", nil, new(*UnknownPieceError)},
+		{"o..\n...\n", "v", nil, new(*SpecError)},
+		{"o.o\n...\n", "o", nil, new(*SpecError)},
+		{"..\n.o\n", "o3", mask, new(*ParseError)},
+		{"...\n...\n", "o3", mask, new(*ParseError)},
+	} {
+		layout, err := ParseLayout(strings.NewReader(bad.layout))
+		if err == nil {
+			_, err = NewPartialBoard(lib, layout, bad.mask, bad.spec)
+		}
+		if !errors.As(err, bad.err) {
+			t.Errorf("expected %T for %q with spec %s, got %v", bad.err, bad.layout, bad.spec, err)
+		}
+	}
+}
@@ -1,64 +1,163 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/leonprime/byf/display"
 	"github.com/leonprime/byf/dlx"
 	"github.com/leonprime/byf/game"
 	"io"
+	"math/rand"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
 type Game interface {
-	Coverage() *game.Coverage
+	Coverage() (*game.Coverage, error)
 	Render(io.Writer, []int)
+	Ext() string // the file extension of a rendered solution
 	String() string
 }
 
 type Game2D struct {
+	lib       *game.Library
 	pieceSpec string
 	w, h      int
+	mask      *game.Grid   // the cells of the board from a -mask file, or nil
+	layout    *game.Layout // the board partly laid out in a -layout file, or nil
+	maskName  string       // the name of the -layout or -mask file
 	board     *game.Board
 }
 
-func (g *Game2D) Coverage() *game.Coverage {
-	g.board = game.NewBoard(g.w, g.h, g.pieceSpec)
-	return g.board.Coverage
+func (g *Game2D) Coverage() (*game.Coverage, error) {
+	var err error
+	if g.layout != nil {
+		g.board, err = game.NewPartialBoard(g.lib, g.layout, g.mask, g.pieceSpec)
+	} else if g.mask != nil {
+		g.board, err = game.NewMaskedBoard(g.lib, g.mask, g.pieceSpec)
+	} else {
+		g.board, err = game.NewBoard(g.lib, g.w, g.h, g.pieceSpec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.board.Coverage, nil
 }
 
 func (g *Game2D) Render(w io.Writer, rows []int) {
 	plays := g.board.Play(rows)
+	if g.board.Mask != nil {
+		display.RenderMasked(g.board.Mask, plays, w)
+		return
+	}
 	display.Render(g.board.W, g.board.H, plays, w)
 }
 
+func (g *Game2D) Ext() string {
+	return "png"
+}
+
 func (g *Game2D) String() string {
+	if g.mask != nil || g.layout != nil {
+		return fmt.Sprintf("%s_%s", g.maskName, g.pieceSpec)
+	}
 	return fmt.Sprintf("%dx%d_%s", g.w, g.h, g.pieceSpec)
 }
 
 type Game3D struct {
+	lib       *game.Library
 	pieceSpec string
 	w, h, d   int
+	mask      *game.Grid3D // the cells of the cube from a -mask file, or nil
+	maskName  string
 	cube      *game.Cube
 }
 
-func (g *Game3D) Coverage() *game.Coverage {
-	g.cube = game.NewCube(g.w, g.h, g.d, g.pieceSpec)
-	return g.cube.Coverage
+func (g *Game3D) Coverage() (*game.Coverage, error) {
+	var err error
+	if g.mask != nil {
+		g.cube, err = game.NewMaskedCube(g.lib, g.mask, g.pieceSpec)
+	} else {
+		g.cube, err = game.NewCube(g.lib, g.w, g.h, g.d, g.pieceSpec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.cube.Coverage, nil
 }
 
 func (g *Game3D) Render(w io.Writer, rows []int) {
 	plays := g.cube.Play(rows)
+	if g.mask != nil {
+		display.Render3DMasked(g.mask, plays, w)
+		return
+	}
 	display.Render3D(g.cube.W, g.cube.H, g.cube.D, plays, w)
 }
 
+func (g *Game3D) Ext() string {
+	return "png"
+}
+
 func (g *Game3D) String() string {
+	if g.mask != nil {
+		return fmt.Sprintf("%s_%s", g.maskName, g.pieceSpec)
+	}
 	return fmt.Sprintf("%dx%dx%d_%s", g.w, g.h, g.d, g.pieceSpec)
 }
 
+// an exact cover problem read from a file in the format of Knuth's dlx programs
+type DLXGame struct {
+	filename string
+	problem  *dlx.Problem
+}
+
+func (g *DLXGame) Coverage() (*game.Coverage, error) {
+	f, err := os.Open(g.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	g.problem, err = dlx.ReadProblem(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", g.filename, err)
+	}
+	p := g.problem
+	cov := &game.Coverage{
+		Columns:   p.Columns,
+		Secondary: p.Secondary,
+		Colors:    p.Colors,
+		Options:   p.Options,
+	}
+	for x := range p.Lo {
+		cov.Bounds = append(cov.Bounds, game.Bound{Min: p.Lo[x], Max: p.Hi[x]})
+	}
+	return cov, nil
+}
+
+// writes the options of the solution a line each
+func (g *DLXGame) Render(w io.Writer, rows []int) {
+	for _, y := range rows {
+		fmt.Fprintln(w, g.problem.OptionString(y))
+	}
+}
+
+func (g *DLXGame) Ext() string {
+	return "txt"
+}
+
+func (g *DLXGame) String() string {
+	return strings.TrimSuffix(filepath.Base(g.filename), filepath.Ext(g.filename))
+}
+
 func main() {
 	max := flag.Int("max", 0, "max solutions to find.  0 means find all (default 0)")
 	nprint := flag.Int("print", 10, "number of solutions to print")
@@ -70,30 +169,174 @@ func main() {
 	debugCoverage := flag.Bool("debugCoverage", false, "debug coverage matrix")
 	debugDLX := flag.Bool("debugDLX", false, "debug DLX algorithm")
 	show := flag.Bool("show", false, "print available pieces and quit")
-	nochiral := flag.Bool("nochiral", false, "don't include the chiral reflections. the first one found in data file is used")
+	nochiral := flag.Bool("nochiral", false, "don't flip pieces over, only rotate them as drawn in the data file.  a flat piece is still flipped over in a cube, where that's a turn")
+	workers := flag.Int("workers", 1, "number of goroutines to search with.  1 searches serially")
+	split := flag.Int("split", 1, "depth of the search tree at which to split work between workers")
+	optionalPieces := flag.Bool("optionalPieces", false, "use each piece at most once instead of exactly once")
+	optionalCells := flag.Bool("optionalCells", false, "allow cells of the board to be left empty")
+	estimate := flag.Bool("estimate", false, "estimate the size of the search with random probes instead of searching")
+	probes := flag.Int("probes", 1000, "number of random probes for -estimate and -unbiased")
+	seed := flag.Int64("seed", 1, "random seed for -estimate, -zdd, -random and -chooser random")
+	random := flag.Int("random", 0, "write this many random solutions, each the first found by a search with the rows shuffled")
+	unbiased := flag.Bool("unbiased", false, "make the -random solutions equally likely, picked from -probes random paths down the search tree")
+	count := flag.Bool("count", false, "only count the solutions, and print the nodes and updates at each level of the search")
+	stats := flag.String("stats", "", "like -count, but print the search stats as a \"table\" or as \"json\"")
+	zdd := flag.Bool("zdd", false, "count the solutions with a ZDD of them all instead of searching, and write -print of them sampled at random")
+	flat := flag.Bool("flat", false, "search with the faster flat array dancing links.  it only does a plain serial search")
+	chooser := flag.String("chooser", "mrv", "how to choose the column to branch on: mrv, last, random, pieces or cells")
+	priority := flag.String("priority", "", "comma separated columns, like Y,c0, to branch on in that order before the rest")
+	checkpoint := flag.String("checkpoint", "", "file to save the search position to periodically and when interrupted")
+	interval := flag.Duration("interval", 5*time.Minute, "how often to save the -checkpoint file")
+	resume := flag.String("resume", "", "checkpoint file to resume the search from")
+	cnf := flag.String("cnf", "", "write the coverage matrix as DIMACS CNF for a SAT solver and quit.  - for stdout")
+	encoding := flag.String("encoding", "sequential", "how -cnf encodes that at most one row covers a column: pairwise or sequential")
+	model := flag.String("model", "", "render the solution in a SAT solver's model of the -cnf file instead of searching")
+	mask := flag.String("mask", "", "file drawing the cells of the board or cube to play in, like a piece.  the game is then just the pieceSpec")
+	layout := flag.String("layout", "", "file laying out a board partly, with the pieces fixed in it and the cells blocked.  the game is then just the pieceSpec")
+	dump := flag.String("dump", "", "write the coverage matrix to a file in the format of Knuth's dlx programs and quit.  - for stdout")
 
 	flag.Usage = func() {
 		f := flag.CommandLine.Output()
-		fmt.Fprintf(f, "Usage: %s [options] w h pieceSpec\n", os.Args[0])
-		fmt.Fprintf(f, "  w and h are the board width and height\n")
+		fmt.Fprintf(f, "Usage: %s [options] w h [d] pieceSpec\n", os.Args[0])
+		fmt.Fprintf(f, "       %s [options] -mask file pieceSpec\n", os.Args[0])
+		fmt.Fprintf(f, "       %s [options] -layout file [-mask file] pieceSpec\n", os.Args[0])
+		fmt.Fprintf(f, "       %s [options] dlx file\n", os.Args[0])
+		fmt.Fprintf(f, "  w and h are the board width and height, and d the depth of a cube\n")
 		fmt.Fprintf(f, "  pieceSpec is the set of pieces to play with (see data/gagne.txt)\n")
+		fmt.Fprintf(f, "  a piece can be followed by a count like o2 or a range like o1-3\n")
 		fmt.Fprintf(f, "Example: %s 5 3 otzvI\n", os.Args[0])
 		fmt.Fprintf(f, "  the solutions are saved at ${path}/solutions/5x3_otzvI\n")
+		fmt.Fprintf(f, "dlx solves an exact cover problem written for Knuth's dlx programs\n")
 		fmt.Fprintf(f, "Options:\n")
 		flag.PrintDefaults()
 		os.Exit(2)
 	}
 	flag.Parse()
 
-	game.LoadPieces(*pieces, !*nochiral)
 	if *show {
-		for _, piece := range game.AllPieces() {
+		lib, err := game.LoadLibrary(*pieces, !*nochiral)
+		if err != nil {
+			fail(err)
+		}
+		for _, piece := range lib.Pieces() {
 			fmt.Println(piece)
 		}
 		return
 	}
 
 	args := flag.Args()
+	var g Game
+	if len(args) > 0 && args[0] == "dlx" {
+		if len(args) != 2 {
+			flag.Usage()
+		}
+		if *optionalPieces || *optionalCells || *mask != "" || *layout != "" {
+			fmt.Fprintf(os.Stderr, "-optionalPieces, -optionalCells, -mask and -layout are for games, not dlx files\n")
+			os.Exit(2)
+		}
+		g = &DLXGame{filename: args[1]}
+	} else {
+		lib, err := game.LoadLibrary(*pieces, !*nochiral)
+		if err == nil {
+			lib, err = lib.WithDebug(game.DebugOptions{
+				Coverage:  *debugCoverage || *debug,
+				AllPieces: *debugAllPieces || *debug,
+				Piece:     *debugPiece,
+			})
+		}
+		if err != nil {
+			fail(err)
+		}
+		if *layout != "" {
+			g = newPartialGame(lib, *layout, *mask, args)
+		} else if *mask != "" {
+			g = newMaskedGame(lib, *mask, args)
+		} else {
+			g = newGame(lib, args)
+		}
+	}
+	if (*checkpoint != "" || *resume != "") && *workers > 1 {
+		fmt.Fprintf(os.Stderr, "-checkpoint and -resume only work with a serial search\n")
+		os.Exit(2)
+	}
+	switch *chooser {
+	case "mrv", "last", "random", "pieces", "cells":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown -chooser %s\n", *chooser)
+		os.Exit(2)
+	}
+	if *chooser == "random" && (*workers > 1 || *checkpoint != "" || *resume != "") {
+		fmt.Fprintf(os.Stderr, "-chooser random can't be used with -workers, -checkpoint or -resume\n")
+		os.Exit(2)
+	}
+	if *flat && (*workers > 1 || *checkpoint != "" || *resume != "" || *count || *stats != "" ||
+		*estimate || *chooser != "mrv" || *priority != "") {
+		fmt.Fprintf(os.Stderr, "-flat only does a plain serial search\n")
+		os.Exit(2)
+	}
+	if *zdd && (*workers > 1 || *checkpoint != "" || *resume != "" || *count || *stats != "" ||
+		*estimate || *flat || *max != 0) {
+		fmt.Fprintf(os.Stderr, "-zdd can't be used with other search options\n")
+		os.Exit(2)
+	}
+	if *random > 0 && (*workers > 1 || *checkpoint != "" || *resume != "" || *count || *stats != "" ||
+		*estimate || *flat || *zdd) {
+		fmt.Fprintf(os.Stderr, "-random can't be used with other search options\n")
+		os.Exit(2)
+	}
+	if *unbiased && *random == 0 {
+		fmt.Fprintf(os.Stderr, "-unbiased is for -random\n")
+		os.Exit(2)
+	}
+	if *stats != "" && *stats != "table" && *stats != "json" {
+		fmt.Fprintf(os.Stderr, "-stats must be table or json\n")
+		os.Exit(2)
+	}
+	if (*count || *stats != "") && (*workers > 1 || *checkpoint != "" || *resume != "") {
+		fmt.Fprintf(os.Stderr, "-count and -stats can't be used with -workers, -checkpoint or -resume\n")
+		os.Exit(2)
+	}
+
+	opts := &options{
+		nprint:         *nprint,
+		max:            *max,
+		workers:        *workers,
+		split:          *split,
+		optionalPieces: *optionalPieces,
+		optionalCells:  *optionalCells,
+		estimate:       *estimate,
+		count:          *count || *stats != "",
+		stats:          *stats,
+		probes:         *probes,
+		seed:           *seed,
+		flat:           *flat,
+		zdd:            *zdd,
+		random:         *random,
+		unbiased:       *unbiased,
+		chooser:        *chooser,
+		priority:       *priority,
+		checkpoint:     *checkpoint,
+		interval:       *interval,
+		resume:         *resume,
+		dump:           *dump,
+		debugDLX:       *debugDLX || *debug,
+		cnf:            *cnf,
+		model:          *model,
+	}
+	switch *encoding {
+	case "pairwise":
+		opts.encoding = dlx.Pairwise
+	case "sequential":
+		opts.encoding = dlx.Sequential
+	default:
+		fmt.Fprintf(os.Stderr, "-encoding must be pairwise or sequential\n")
+		os.Exit(2)
+	}
+	run(g, *path, opts)
+}
+
+// parses the arguments for a 2D or 3D game
+func newGame(lib *game.Library, args []string) Game {
 	var (
 		dim       int
 		w, h, d   int
@@ -127,85 +370,496 @@ func main() {
 	if dim == 3 && d == 0 {
 		flag.Usage()
 	}
+	if dim == 2 {
+		return &Game2D{lib: lib, w: w, h: h, pieceSpec: pieceSpec}
+	}
+	return &Game3D{lib: lib, w: w, h: h, d: d, pieceSpec: pieceSpec}
+}
+
+// makes a 2D or 3D game of the cells in the mask file, depending on how many
+// layers it has.  the only argument is the pieceSpec
+func newMaskedGame(lib *game.Library, maskFile string, args []string) Game {
+	if len(args) != 1 || len(args[0]) == 0 {
+		flag.Usage()
+	}
+	mask, err := game.LoadMask(maskFile)
+	if err != nil {
+		fail(err)
+	}
+	name := strings.TrimSuffix(filepath.Base(maskFile), filepath.Ext(maskFile))
+	if mask.D == 1 {
+		return &Game2D{lib: lib, pieceSpec: args[0], w: mask.W, h: mask.H, mask: mask.GetPlaneZ(0), maskName: name}
+	}
+	return &Game3D{lib: lib, pieceSpec: args[0], w: mask.W, h: mask.H, d: mask.D, mask: mask, maskName: name}
+}
+
+// makes a 2D game of the board laid out in the layout file, on the cells in
+// the mask file if there is one.  the only argument is the pieceSpec
+func newPartialGame(lib *game.Library, layoutFile, maskFile string, args []string) Game {
+	if len(args) != 1 || len(args[0]) == 0 {
+		flag.Usage()
+	}
+	layout, err := game.LoadLayout(layoutFile)
+	if err != nil {
+		fail(err)
+	}
+	g := &Game2D{lib: lib, pieceSpec: args[0], w: layout.W, h: layout.H, layout: layout}
+	if maskFile != "" {
+		mask, err := game.LoadMask(maskFile)
+		if err != nil {
+			fail(err)
+		}
+		if mask.D != 1 {
+			fmt.Fprintf(os.Stderr, "-layout only lays out a board, but the -mask file is a cube\n")
+			os.Exit(2)
+		}
+		g.mask = mask.GetPlaneZ(0)
+	}
+	g.maskName = strings.TrimSuffix(filepath.Base(layoutFile), filepath.Ext(layoutFile))
+	return g
+}
+
+// search and output options
+type options struct {
+	nprint, max    int
+	workers, split int
+	optionalPieces bool
+	optionalCells  bool
+	estimate       bool
+	count          bool
+	stats          string
+	probes         int
+	seed           int64
+	flat           bool
+	zdd            bool
+	random         int
+	unbiased       bool
+	chooser        string
+	priority       string
+	checkpoint     string
+	interval       time.Duration
+	resume         string
+	dump           string
+	debugDLX       bool
+	cnf            string
+	encoding       dlx.Encoding
+	model          string
+}
 
-	if *debugPiece != "" {
-		game.SetDebugPiece(*debugPiece)
+func run(g Game, path string, opts *options) {
+	nprint, max := opts.nprint, opts.max
+	cov, err := g.Coverage()
+	if err != nil {
+		fail(err)
 	}
-	if *debugAllPieces {
-		game.SetDebugAllPieces()
+	if opts.optionalPieces {
+		cov.OptionalPieces()
 	}
-	if *debugCoverage {
-		game.SetDebugCoverage()
+	if opts.optionalCells {
+		cov.OptionalCells()
 	}
-	if *debugDLX {
-		dlx.SetDebug()
+	renderDebugs(cov.Debugs, g.String(), path)
+	if opts.dump != "" {
+		dumpCoverage(cov, opts.dump, (*dlx.Problem).Write)
+		return
 	}
-	if *debug {
-		game.SetDebugAllPieces()
-		game.SetDebugCoverage()
-		dlx.SetDebug()
+	if opts.cnf != "" {
+		dumpCoverage(cov, opts.cnf, func(p *dlx.Problem, w io.Writer) error {
+			return p.WriteCNF(w, opts.encoding)
+		})
+		return
+	}
+	if opts.model != "" {
+		soln := readModel(cov, opts.model)
+		gamePath := renderSolutions(g, []dlx.Solution{soln}, path)
+		fmt.Printf("wrote the solution from %s to %s\n", opts.model, gamePath)
+		return
 	}
 
-	var g Game
-	if dim == 2 {
-		g = &Game2D{w: w, h: h, pieceSpec: pieceSpec}
+	if opts.zdd {
+		runZDD(g, cov, path, opts)
+		return
+	}
+
+	if opts.flat {
+		runFlat(g, cov, path, opts)
+		return
+	}
+
+	dl, err := dlx.Build(cov.Options, cov.Columns, cov.Secondary, cov.Colors)
+	if err != nil {
+		fail(err)
+	}
+	for x, bound := range cov.Bounds {
+		secondary := cov.Secondary != nil && cov.Secondary[x]
+		if !secondary && (bound.Min != 1 || bound.Max != 1) {
+			if err := dl.SetBounds(x, bound.Min, bound.Max); err != nil {
+				fail(err)
+			}
+		}
+	}
+	dl.SetChooser(newChooser(cov, opts))
+	dl.Debug(opts.debugDLX)
+
+	if opts.estimate {
+		est := dl.Estimate(opts.probes, rand.New(rand.NewSource(opts.seed)))
+		fmt.Printf("estimate for game \"%s\":\n", g)
+		fmt.Printf("\tnodes: %.4g\n", est.Nodes)
+		fmt.Printf("\tsolutions: %.4g\n", est.Solutions)
+		fmt.Printf("\tsteps: %.4g\n", est.Steps)
+		fmt.Printf("\ttime: about %s at %.4g steps/s\n", approxTime(est.Seconds()), est.Rate)
+		return
+	}
+
+	if opts.random > 0 {
+		runRandom(g, dl, path, opts)
+		return
+	}
+
+	if opts.count {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		stats, err := dl.Count(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "search interrupted: %s\n", err)
+		}
+		switch opts.stats {
+		case "table":
+			fmt.Printf("stats for game \"%s\":\n", g)
+			stats.WriteTable(os.Stdout)
+		case "json":
+			b, _ := json.MarshalIndent(stats, "", "  ")
+			fmt.Println(string(b))
+		default:
+			stats.Write(os.Stdout)
+		}
+		return
+	}
+
+	var cp *dlx.Checkpoint
+	if opts.resume != "" {
+		cp = readCheckpoint(opts.resume)
+	}
+	if opts.checkpoint != "" {
+		dl.SetCheckpoint(opts.interval, func(cp *dlx.Checkpoint) {
+			// keep searching, the next save may work
+			if err := writeCheckpoint(opts.checkpoint, cp); err != nil {
+				fmt.Fprintf(os.Stderr, "\rcan't save the search position: %s\n", err)
+			}
+		})
+	}
+
+	// stop the search and print what's found if interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &collector{nprint: nprint, max: max}
+	if cp != nil {
+		c.n = cp.N
+	}
+	collect := c.collect
+
+	start := time.Now()
+	if opts.workers > 1 {
+		// the workers only wait on the merge for solutions that are wanted
+		if nprint == 0 && max == 0 {
+			collect = nil
+		}
+		err = dl.SearchParallel(ctx, opts.workers, opts.split, collect)
+	} else if cp != nil {
+		err = dl.Resume(ctx, cp, collect)
 	} else {
-		g = &Game3D{w: w, h: h, d: d, pieceSpec: pieceSpec}
+		err = dl.Search(ctx, collect)
+	}
+	if err == dlx.ErrCheckpoint || err == dlx.ErrChooser {
+		fmt.Fprintf(os.Stderr, "\rcan't resume from %s: %s\n", opts.resume, err)
+		os.Exit(1)
+	}
+	var saveErr error
+	if err != nil {
+		fmt.Printf("\rsearch interrupted: %s\n", err)
+		if opts.checkpoint != "" && dl.Halted() != nil {
+			if saveErr = writeCheckpoint(opts.checkpoint, dl.Halted()); saveErr == nil {
+				fmt.Printf("saved the search position to %s\n", opts.checkpoint)
+			}
+		}
+	}
+
+	printSolutions(g, dl.N, dl.S, c.solutions, path, start)
+	if saveErr != nil {
+		fail(fmt.Errorf("can't save the search position: %w", saveErr))
 	}
-	run(g, *path, *nprint, *max)
 }
 
-func run(g Game, path string, nprint, max int) {
-	cov := g.Coverage()
-	renderDebugs(cov.Debugs, g.String(), path)
+// keeps the first nprint solutions found and stops the search at max,
+// counting from n
+type collector struct {
+	n, nprint, max int
+	solutions      []dlx.Solution
+}
+
+func (c *collector) collect(soln dlx.Solution) bool {
+	c.n++
+	if c.n%1000 == 0 {
+		fmt.Printf("\rfound %d solutions", c.n)
+	}
+	if len(c.solutions) < c.nprint {
+		c.solutions = append(c.solutions, soln)
+	}
+	return c.max == 0 || c.n < c.max
+}
 
-	dl := dlx.New(cov.M.Cells, cov.Columns, max, nprint)
+// searches with the flat dancing links, which only do a plain serial search
+func runFlat(g Game, cov *game.Coverage, path string, opts *options) {
+	for _, bound := range cov.Bounds {
+		if bound.Min != 1 || bound.Max != 1 {
+			fmt.Fprintf(os.Stderr, "-flat can't be used with piece counts\n")
+			os.Exit(2)
+		}
+	}
+	if cov.Colors != nil {
+		fmt.Fprintf(os.Stderr, "-flat can't be used with colors\n")
+		os.Exit(2)
+	}
+	f := dlx.NewFlatSparse(cov.Options, cov.Columns, cov.Secondary)
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	c := &collector{nprint: opts.nprint, max: opts.max}
 	start := time.Now()
+	if err := f.Search(ctx, c.collect); err != nil {
+		fmt.Printf("\rsearch interrupted: %s\n", err)
+	}
+	printSolutions(g, f.N, f.S, c.solutions, path, start)
+}
 
-	// print if interrupted
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		<-c
-		printSolutions(g, dl, path, nprint, start)
-		os.Exit(0)
-	}()
+// counts the solutions with a ZDD and renders random samples of them
+func runZDD(g Game, cov *game.Coverage, path string, opts *options) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	z, err := cov.Problem().ZDD(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't build the ZDD: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("found %s solutions for game \"%s\"\n", z.Count(), g)
+	fmt.Printf("\ttime taken: %s\n", time.Now().Sub(start))
+	fmt.Printf("\tZDD nodes: %d\n", len(z.Nodes))
+	if z.Count().Sign() == 0 || opts.nprint == 0 {
+		return
+	}
+	rng := rand.New(rand.NewSource(opts.seed))
+	solutions := make([]dlx.Solution, opts.nprint)
+	for i := range solutions {
+		solutions[i] = z.Sample(rng)
+	}
+	gamePath := renderSolutions(g, solutions, path)
+	fmt.Printf("wrote %d random solutions to %s\n", len(solutions), gamePath)
+}
 
-	dl.Search(0)
+// renders random solutions, found by shuffled searches or sampled without bias
+func runRandom(g Game, dl *dlx.DancingLinks, path string, opts *options) {
+	rng := rand.New(rand.NewSource(opts.seed))
+	start := time.Now()
+	var solutions []dlx.Solution
+	for i := 0; i < opts.random; i++ {
+		var soln dlx.Solution
+		if opts.unbiased {
+			soln = dl.Sample(opts.probes, rng)
+		} else {
+			soln = dl.RandomSolution(rng)
+		}
+		if soln == nil && opts.unbiased {
+			fmt.Printf("none of the %d probes reached a solution, try more -probes\n", opts.probes)
+			break
+		}
+		if soln == nil {
+			break
+		}
+		solutions = append(solutions, soln)
+	}
+	if len(solutions) == 0 {
+		fmt.Printf("found no solutions for game \"%s\"\n", g)
+		return
+	}
+	gamePath := renderSolutions(g, solutions, path)
+	fmt.Printf("wrote %d random solutions to %s in %s\n", len(solutions), gamePath, time.Now().Sub(start))
+}
 
-	printSolutions(g, dl, path, nprint, start)
+// the column chooser for the options.  a priority overrides the chooser
+func newChooser(cov *game.Coverage, opts *options) dlx.ColumnChooser {
+	if opts.priority != "" {
+		first := strings.Split(opts.priority, ",")
+		index := make(map[string]int)
+		for x, name := range cov.Columns {
+			index[name] = x
+		}
+		p := make(dlx.Priority, len(cov.Columns))
+		for x := range p {
+			p[x] = len(first)
+		}
+		for i, name := range first {
+			x, ok := index[name]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "unknown -priority column %s\n", name)
+				os.Exit(2)
+			}
+			p[x] = i
+		}
+		return p
+	}
+	switch opts.chooser {
+	case "last":
+		return dlx.MRVLast{}
+	case "random":
+		return dlx.NewMRVRandom(rand.New(rand.NewSource(opts.seed)))
+	case "pieces":
+		return dlx.PreferFirst(cov.Pieces, len(cov.Columns))
+	case "cells":
+		return dlx.PreferLast(cov.Pieces, len(cov.Columns))
+	}
+	return nil
 }
 
-func printSolutions(g Game, dl *dlx.DancingLinks, path string, nprint int, start time.Time) {
-	if dl.N >= 1000 {
+func printSolutions(g Game, n, steps int, solutions []dlx.Solution, path string, start time.Time) {
+	if n >= 1000 {
 		fmt.Print("\r") // clear out the count feedback
 	}
-	fmt.Printf("found %d solutions for game \"%s\"\n", dl.N, g)
+	fmt.Printf("found %d solutions for game \"%s\"\n", n, g)
 	fmt.Printf("\ttime taken: %s\n", time.Now().Sub(start))
-	fmt.Printf("\tsteps: %d\n", dl.S)
+	fmt.Printf("\tsteps: %d\n", steps)
 
-	if len(dl.Solutions) == 0 {
+	if len(solutions) == 0 {
 		return
 	}
+	gamePath := renderSolutions(g, solutions, path)
+	quant := "the first"
+	if n == len(solutions) {
+		quant = "all"
+	}
+	fmt.Printf("wrote %s %d solutions to %s\n", quant, len(solutions), gamePath)
+}
+
+// renders the solutions to files in the game's solutions directory and returns
+// it.  a file that can't be written fails
+func renderSolutions(g Game, solutions []dlx.Solution, path string) string {
 	gamePath := fmt.Sprintf("%s/solutions/%s", path, g)
 	os.RemoveAll(gamePath)
-	os.MkdirAll(gamePath, os.ModePerm)
+	if err := os.MkdirAll(gamePath, os.ModePerm); err != nil {
+		fail(err)
+	}
 
-	for i, solution := range dl.Solutions {
-		filename := fmt.Sprintf("%s/%d.png", gamePath, i)
+	for i, solution := range solutions {
+		filename := fmt.Sprintf("%s/%d.%s", gamePath, i, g.Ext())
 		f, err := os.Create(filename)
 		if err != nil {
-			panic(err)
+			fail(err)
 		}
 		g.Render(f, solution)
 		f.Close()
 	}
-	quant := "the first"
-	if dl.N == nprint {
-		quant = "all"
+	return gamePath
+}
+
+// writes the coverage to a file, or stdout for -, with the write function
+// of its problem, like Problem.Write
+func dumpCoverage(cov *game.Coverage, filename string, write func(*dlx.Problem, io.Writer) error) {
+	w := os.Stdout
+	if filename != "-" {
+		f, err := os.Create(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(cov.Problem(), w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// reads a SAT model of the coverage's CNF and checks it's a solution
+func readModel(cov *game.Coverage, filename string) dlx.Solution {
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	soln, err := dlx.ReadModel(f, len(cov.Options))
+	if err == nil {
+		err = cov.Problem().Verify(soln)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+		os.Exit(1)
+	}
+	return soln
+}
+
+func readCheckpoint(filename string) *dlx.Checkpoint {
+	f, err := os.Open(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	cp, err := dlx.ReadCheckpoint(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filename, err)
+		os.Exit(1)
+	}
+	return cp
+}
+
+// writes to a temporary file first so a crash never leaves a partial checkpoint.
+// on an error the last checkpoint saved is left as it was
+func writeCheckpoint(filename string, cp *dlx.Checkpoint) error {
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = cp.Write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// reports an error on bad input and exits
+func fail(err error) {
+	var (
+		unknown *game.UnknownPieceError
+		parse   *game.ParseError
+	)
+	switch {
+	case errors.As(err, &unknown):
+		fmt.Fprintf(os.Stderr, "%s.  -show lists the pieces of the -pieces file\n", err)
+	case errors.As(err, &parse):
+		fmt.Fprintf(os.Stderr, "can't read the file: %s\n", err)
+	default:
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(1)
+}
+
+// formats a number of seconds that can be far too large for a time.Duration
+func approxTime(secs float64) string {
+	const year = 365 * 24 * 60 * 60
+	if secs > 100*year {
+		return fmt.Sprintf("%.3g years", secs/year)
 	}
-	fmt.Printf("wrote %s %d solutions to %s\n", quant, len(dl.Solutions), gamePath)
+	return time.Duration(secs * float64(time.Second)).Round(time.Second).String()
 }
 
 func renderDebugs(debugs []*game.Debug, gameName, path string) {